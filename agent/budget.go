@@ -0,0 +1,324 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+	"github.com/shopwarelabs/copilot-extension/copilot"
+	"github.com/shopwarelabs/copilot-extension/retrieval"
+)
+
+const (
+	defaultContextTokens  = 32768
+	defaultResponseTokens = 4096
+	defaultToolTokens     = 8192
+
+	// messageOverheadTokens approximates the tokens the chat format adds to
+	// every message
+	messageOverheadTokens = 4
+
+	// minChunkTokens is the smallest remainder a chunk is trimmed to, below it
+	// the chunk is dropped
+	minChunkTokens = 200
+
+	// toolResultShare is the number of tool results which fit into the tool
+	// budget at their maximum size, so one result can't use all of it
+	toolResultShare = 4
+
+	summaryPrompt = "Summarize the following conversation between a developer and an assistant about Shopware 6 development in a few sentences. " +
+		"Keep identifiers, versions, decisions and open questions, leave out pleasantries."
+)
+
+var (
+	tokenCountersMu sync.Mutex
+	tokenCounters   = make(map[copilot.Model]*tokenCounter)
+)
+
+func init() {
+	// The encodings are embedded, tiktoken would download them on first use
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// tokenCounter counts tokens with the encoding of a model. When the encoding
+// cannot be loaded, it falls back to an estimate of four characters per token.
+type tokenCounter struct {
+	once     sync.Once
+	encoding *tiktoken.Tiktoken
+}
+
+func tokenCounterFor(model copilot.Model) *tokenCounter {
+	tokenCountersMu.Lock()
+	counter, ok := tokenCounters[model]
+	if !ok {
+		counter = &tokenCounter{}
+		tokenCounters[model] = counter
+	}
+	tokenCountersMu.Unlock()
+
+	// Loading an encoding takes a while, requests for other models don't wait
+	// for it
+	counter.once.Do(func() {
+		encoding, err := tiktoken.EncodingForModel(string(model))
+		if err != nil {
+			encoding, err = tiktoken.GetEncoding(tiktoken.MODEL_CL100K_BASE)
+		}
+
+		if err != nil {
+			log.Warnf("failed to load token encoding for %s, estimating tokens: %v", model, err)
+			return
+		}
+
+		counter.encoding = encoding
+	})
+
+	return counter
+}
+
+func (t *tokenCounter) count(text string) int {
+	if t.encoding == nil {
+		return (len(text) + 3) / 4
+	}
+
+	return len(t.encoding.EncodeOrdinary(text))
+}
+
+func (t *tokenCounter) countMessage(msg copilot.ChatMessage) int {
+	tokens := messageOverheadTokens + t.count(msg.Content)
+
+	for _, toolCall := range msg.ToolCalls {
+		if toolCall.Function != nil {
+			tokens += t.count(toolCall.Function.Name) + t.count(toolCall.Function.Arguments)
+		}
+	}
+
+	return tokens
+}
+
+// truncate shortens text to at most limit tokens.
+func (t *tokenCounter) truncate(text string, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+
+	if t.encoding == nil {
+		if len(text) <= limit*4 {
+			return text
+		}
+
+		return truncateBytes(text, limit*4)
+	}
+
+	tokens := t.encoding.EncodeOrdinary(text)
+	if len(tokens) <= limit {
+		return text
+	}
+
+	// A character may be encoded by several tokens, the last one can be
+	// incomplete
+	return strings.ToValidUTF8(t.encoding.Decode(tokens[:limit]), "")
+}
+
+// truncateBytes shortens text to at most n bytes without splitting a
+// character.
+func truncateBytes(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+
+	return text[:n]
+}
+
+// tokenBudget splits the context window of the model between the system
+// prompt, the conversation, the retrieved chunks, tool results and the
+// answer.
+type tokenBudget struct {
+	counter *tokenCounter
+
+	// prompt is what is left for the system prompt, the conversation and the
+	// retrieved chunks
+	prompt int
+
+	// tools is what is left for tool results
+	tools int
+
+	// toolResult is the maximum size of a single tool result
+	toolResult int
+}
+
+func (s *Service) newTokenBudget(model copilot.Model) *tokenBudget {
+	contextTokens := s.options.ContextTokens
+	if contextTokens <= 0 {
+		contextTokens = defaultContextTokens
+	}
+
+	responseTokens := s.options.ResponseTokens
+	if responseTokens <= 0 {
+		responseTokens = defaultResponseTokens
+	}
+
+	toolTokens := s.options.ToolTokens
+	if toolTokens <= 0 {
+		toolTokens = defaultToolTokens
+	}
+
+	return &tokenBudget{
+		counter: tokenCounterFor(model),
+		prompt:  max(contextTokens-responseTokens-toolTokens, 0),
+		tools:   toolTokens,
+	}
+}
+
+// startTools moves the prompt budget which is still left to the tool results
+// if unusedPrompt is set and limits the size of a single result. It is called
+// once the prompt is complete.
+func (b *tokenBudget) startTools(unusedPrompt bool) {
+	if unusedPrompt {
+		b.tools += b.prompt
+		b.prompt = 0
+	}
+
+	b.toolResult = max(b.tools/toolResultShare, minChunkTokens)
+}
+
+// reserve takes the tokens of text from the prompt budget.
+func (b *tokenBudget) reserve(text string) {
+	b.prompt = max(b.prompt-b.counter.count(text)-messageOverheadTokens, 0)
+}
+
+// packHistory keeps the most recent messages which fit into limit tokens. The
+// latest message is always kept. Older messages are replaced by a summary, so
+// the model still knows what the conversation was about.
+func (s *Service) packHistory(ctx context.Context, integrationID, apiToken string, budget *tokenBudget, history []copilot.ChatMessage, limit int) []copilot.ChatMessage {
+	used := 0
+	keepFrom := len(history)
+
+	for i := len(history) - 1; i >= 0; i-- {
+		tokens := budget.counter.countMessage(history[i])
+		if used+tokens > limit && i < len(history)-1 {
+			break
+		}
+
+		used += tokens
+		keepFrom = i
+	}
+
+	kept := history[keepFrom:]
+	dropped := history[:keepFrom]
+
+	if len(dropped) > 0 {
+		summary := s.summarizeHistory(ctx, integrationID, apiToken, dropped)
+		summary = budget.counter.truncate(summary, max(limit-used, limit/4))
+
+		log.Infof("Summarized %d messages of the conversation", len(dropped))
+
+		kept = append([]copilot.ChatMessage{{
+			Role:    "system",
+			Content: "Summary of the earlier conversation: " + summary,
+		}}, kept...)
+		used += budget.counter.count(summary) + messageOverheadTokens
+	}
+
+	budget.prompt = max(budget.prompt-used, 0)
+
+	return kept
+}
+
+// summarizeHistory asks the model to summarize the given messages. If that
+// fails, the beginning of every message is used instead.
+func (s *Service) summarizeHistory(ctx context.Context, integrationID, apiToken string, messages []copilot.ChatMessage) string {
+	var transcript strings.Builder
+
+	for _, msg := range messages {
+		if strings.TrimSpace(msg.Content) == "" {
+			continue
+		}
+
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, msg.Content)
+	}
+
+	summary, err := s.collectCompletion(ctx, integrationID, apiToken, &copilot.ChatCompletionsRequest{
+		Model: s.defaultModel(),
+		Messages: []copilot.ChatMessage{
+			{Role: "system", Content: summaryPrompt},
+			{Role: "user", Content: transcript.String()},
+		},
+		Stream: true,
+	})
+	if err == nil && strings.TrimSpace(summary) != "" {
+		return strings.TrimSpace(summary)
+	}
+
+	log.Warnf("failed to summarize conversation, using excerpts: %v", err)
+
+	var excerpts strings.Builder
+
+	for _, msg := range messages {
+		content := strings.Join(strings.Fields(msg.Content), " ")
+		if content == "" {
+			continue
+		}
+
+		if len(content) > 200 {
+			content = truncateBytes(content, 200) + "..."
+		}
+
+		fmt.Fprintf(&excerpts, "%s: %s\n", msg.Role, content)
+	}
+
+	return excerpts.String()
+}
+
+// packContext selects the retrieved documents, best ranked first, which fit
+// into the remaining prompt budget. The first document not fitting anymore is
+// trimmed if a meaningful part of it fits, all following ones are dropped.
+func packContext(budget *tokenBudget, docs []retrieval.Result) []retrieval.Result {
+	packed := make([]retrieval.Result, 0, len(docs))
+
+	for _, doc := range docs {
+		tokens := budget.counter.count(doc.Content)
+
+		if tokens <= budget.prompt {
+			budget.prompt -= tokens
+			packed = append(packed, doc)
+			continue
+		}
+
+		if budget.prompt >= minChunkTokens {
+			doc.Content = budget.counter.truncate(doc.Content, budget.prompt)
+			budget.prompt = 0
+			packed = append(packed, doc)
+		}
+
+		break
+	}
+
+	if dropped := len(docs) - len(packed); dropped > 0 {
+		log.Infof("Dropped %d retrieved documents exceeding the token budget", dropped)
+	}
+
+	return packed
+}
+
+// packToolResult trims the content of a tool result to the size limit of a
+// single result and the remaining tool budget.
+func packToolResult(budget *tokenBudget, msg *copilot.ChatMessage) {
+	tokens := budget.counter.count(msg.Content)
+	limit := min(budget.toolResult, budget.tools)
+
+	if tokens > limit {
+		msg.Content = budget.counter.truncate(msg.Content, limit) + "\n\n[truncated]"
+		tokens = limit
+	}
+
+	budget.tools -= tokens
+}
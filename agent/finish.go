@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/shopwarelabs/copilot-extension/copilot"
+)
+
+// finishState collects why the model stopped answering, so the user learns
+// why an answer is incomplete instead of getting a silently cut off one.
+type finishState struct {
+	truncated  bool
+	filtered   bool
+	categories []string
+}
+
+// observe records the finish reason and content filter results of a choice.
+func (f *finishState) observe(choice copilot.ChatCompletionsChoice) {
+	if choice.FinishReason != "" {
+		finishReasons.Add(choice.FinishReason, 1)
+	}
+
+	switch choice.FinishReason {
+	case "length":
+		f.truncated = true
+	case "content_filter":
+		f.filtered = true
+	}
+
+	for _, category := range choice.FilteredCategories() {
+		f.filtered = true
+
+		if !slices.Contains(f.categories, category) {
+			f.categories = append(f.categories, category)
+			filteredCategories.Add(category, 1)
+		}
+	}
+}
+
+// write tells the user about a truncated answer with a trailing message and
+// about filtered content with a copilot_errors event.
+func (f *finishState) write(w *sseWriter) error {
+	if f.truncated {
+		if err := w.writeData(sseResponse{
+			Choices: []sseResponseChoice{{
+				Delta: sseResponseMessage{
+					Role:    "assistant",
+					Content: "\n\n_The answer was cut off because it reached the maximum length, ask to continue for the rest._",
+				},
+			}},
+		}); err != nil {
+			return err
+		}
+	}
+
+	if f.filtered {
+		message := "Parts of the answer were removed by the content filter"
+		if len(f.categories) > 0 {
+			message += fmt.Sprintf(" (%s)", strings.Join(f.categories, ", "))
+		}
+
+		return w.writeErrors([]sseError{{
+			Type:       "agent",
+			Code:       "content_filter",
+			Message:    message + ", try to rephrase the question.",
+			Identifier: "content_filter",
+		}})
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shopwarelabs/copilot-extension/retrieval"
+	"github.com/shopwarelabs/copilot-extension/signature"
+)
+
+// readinessTimeout limits all dependency checks together, it stays below the
+// default timeout of Kubernetes probes
+const readinessTimeout = 900 * time.Millisecond
+
+// HealthService answers the liveness and readiness probes.
+type HealthService struct {
+	retriever  *retrieval.Retriever
+	verifier   *signature.Verifier
+	ollamaHost string
+	client     *http.Client
+}
+
+func NewHealthService(retriever *retrieval.Retriever, verifier *signature.Verifier, ollamaHost string) *HealthService {
+	return &HealthService{
+		retriever:  retriever,
+		verifier:   verifier,
+		ollamaHost: strings.TrimSuffix(ollamaHost, "/"),
+		client:     &http.Client{Timeout: readinessTimeout},
+	}
+}
+
+type HealthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Healthz reports that the process is alive.
+func (s *HealthService) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, HealthStatus{Status: "ok"})
+}
+
+// Readyz reports whether the server can answer requests: the collection is
+// loaded and not empty, the embedding backend answers and a key to verify
+// the request signatures is present.
+func (s *HealthService) Readyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]func(context.Context) error{
+		"collection": s.checkCollection,
+		"ollama":     s.checkOllama,
+		"public_key": s.checkPublicKey,
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	type checkResult struct {
+		name string
+		err  error
+	}
+
+	// The checks run concurrently, a check which doesn't finish in time is
+	// reported instead of failing the whole probe
+	results := make(chan checkResult, len(checks))
+	for name, check := range checks {
+		go func() {
+			results <- checkResult{name: name, err: check(ctx)}
+		}()
+	}
+
+	health := HealthStatus{Status: "ok", Checks: make(map[string]string, len(checks))}
+	status := http.StatusOK
+
+	for range checks {
+		select {
+		case result := <-results:
+			if result.err != nil {
+				health.Checks[result.name] = result.err.Error()
+				continue
+			}
+
+			health.Checks[result.name] = "ok"
+		case <-ctx.Done():
+		}
+	}
+
+	for name := range checks {
+		if _, ok := health.Checks[name]; !ok {
+			health.Checks[name] = "timed out"
+		}
+
+		if health.Checks[name] != "ok" {
+			health.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	writeHealth(w, status, health)
+}
+
+func (s *HealthService) checkCollection(ctx context.Context) error {
+	if s.retriever.Collection().Count() == 0 {
+		return errors.New("collection is empty")
+	}
+
+	return nil
+}
+
+func (s *HealthService) checkOllama(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.ollamaHost+"/tags", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ollama is not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ollama answered with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (s *HealthService) checkPublicKey(ctx context.Context) error {
+	if s.verifier.HasKeys() {
+		return nil
+	}
+
+	// Refresh is rate limited, frequent probes don't reach GitHub. It outlives
+	// the probe, so a slow refresh still completes for the next one.
+	if err := s.verifier.Refresh(ctx); err != nil {
+		return fmt.Errorf("failed to load public keys: %w", err)
+	}
+
+	if !s.verifier.HasKeys() {
+		return errors.New("no public keys loaded")
+	}
+
+	return nil
+}
+
+func writeHealth(w http.ResponseWriter, status int, health HealthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(health)
+}
@@ -0,0 +1,30 @@
+package agent
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+)
+
+// The counters are not published through expvar, its handler also exposes
+// the command line and with it secrets passed as flags.
+var (
+	// finishReasons counts the answers by the reason the model stopped, e.g.
+	// stop, length or content_filter
+	finishReasons = new(expvar.Map)
+
+	// filteredCategories counts the content filter categories which removed
+	// parts of an answer
+	filteredCategories = new(expvar.Map)
+)
+
+// Metrics serves the counters of the agent as JSON. It isn't protected, so
+// it belongs on an internal address.
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	fmt.Fprintf(w, "{\n%q: %s,\n%q: %s\n}\n",
+		"agent_finish_reasons", finishReasons.String(),
+		"agent_content_filter_categories", filteredCategories.String(),
+	)
+}
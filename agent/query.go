@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/shopwarelabs/copilot-extension/copilot"
+)
+
+// maxRewriteMessageLength limits how much of each message is passed to the
+// model when rewriting the retrieval query.
+const maxRewriteMessageLength = 1000
+
+const rewritePrompt = "You rewrite the last question of a conversation about Shopware 6 development into a standalone search query for the Shopware documentation and source code. " +
+	"Resolve references like \"that\" or \"it\" using the conversation, keep exact identifiers (class names, events, component names, config keys) unchanged and answer with the query only, without any explanation."
+
+// userTurns returns the content of the last n non-empty user messages, oldest
+// first.
+func userTurns(messages []copilot.ChatMessage, n int) []string {
+	var turns []string
+
+	for i := len(messages) - 1; i >= 0 && len(turns) < n; i-- {
+		msg := messages[i]
+		if msg.Role != "user" || strings.TrimSpace(msg.Content) == "" {
+			continue
+		}
+
+		turns = append([]string{msg.Content}, turns...)
+	}
+
+	return turns
+}
+
+// retrievalQuery builds the query used to retrieve documents for the latest
+// user message. Follow-up questions rarely make sense on their own, so the
+// recent user turns are included as well. With rewriting enabled the model
+// turns the conversation into a standalone query first.
+func (s *Service) retrievalQuery(ctx context.Context, integrationID, apiToken string, messages []copilot.ChatMessage) string {
+	turns := userTurns(messages, max(s.options.QueryTurns, 1))
+	if len(turns) == 0 {
+		return ""
+	}
+
+	query := strings.Join(turns, "\n")
+
+	if !s.options.QueryRewrite || len(userTurns(messages, 2)) < 2 {
+		return query
+	}
+
+	rewritten, err := s.rewriteQuery(ctx, integrationID, apiToken, messages)
+	if err != nil {
+		log.Warnf("failed to rewrite retrieval query, using conversation turns: %v", err)
+		return query
+	}
+
+	return rewritten
+}
+
+// rewriteQuery asks the model to turn the last question of the conversation
+// into a standalone search query.
+func (s *Service) rewriteQuery(ctx context.Context, integrationID, apiToken string, messages []copilot.ChatMessage) (string, error) {
+	var transcript strings.Builder
+
+	for _, msg := range messages {
+		if (msg.Role != "user" && msg.Role != "assistant") || strings.TrimSpace(msg.Content) == "" {
+			continue
+		}
+
+		content := msg.Content
+		if len(content) > maxRewriteMessageLength {
+			content = truncateBytes(content, maxRewriteMessageLength) + "..."
+		}
+
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, content)
+	}
+
+	query, err := s.collectCompletion(ctx, integrationID, apiToken, &copilot.ChatCompletionsRequest{
+		Model: s.defaultModel(),
+		Messages: []copilot.ChatMessage{
+			{Role: "system", Content: rewritePrompt},
+			{Role: "user", Content: transcript.String()},
+		},
+		Stream: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return "", fmt.Errorf("model returned an empty query")
+	}
+
+	return query, nil
+}
+
+// collectCompletion runs a chat completion and returns the whole answer
+// instead of streaming it.
+func (s *Service) collectCompletion(ctx context.Context, integrationID, apiToken string, req *copilot.ChatCompletionsRequest) (string, error) {
+	stream, err := s.provider.StreamChatCompletions(ctx, copilot.Credentials{IntegrationID: integrationID, APIKey: apiToken}, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get chat completions stream: %w", err)
+	}
+
+	var content strings.Builder
+
+	for streamResp := range stream {
+		if streamResp.Error != nil {
+			return "", fmt.Errorf("stream error: %w", streamResp.Error)
+		}
+
+		for _, choice := range streamResp.Response.Choices {
+			content.WriteString(choice.Delta.Content)
+		}
+	}
+
+	return content.String(), nil
+}
@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"github.com/shopwarelabs/copilot-extension/retrieval"
+)
+
+// referenceSet collects the references of an answer, de-duplicated by ID, and
+// remembers which of them have already been sent to the client.
+type referenceSet struct {
+	seen       map[string]struct{}
+	references []sseReference
+	sent       int
+}
+
+func newReferenceSet() *referenceSet {
+	return &referenceSet{
+		seen: make(map[string]struct{}),
+	}
+}
+
+// add appends the references which are not part of the set yet.
+func (r *referenceSet) add(references ...sseReference) {
+	for _, reference := range references {
+		if _, ok := r.seen[reference.ID]; ok {
+			continue
+		}
+
+		r.seen[reference.ID] = struct{}{}
+		r.references = append(r.references, reference)
+	}
+}
+
+// pending returns the references added since the last call and marks them as
+// sent.
+func (r *referenceSet) pending() []sseReference {
+	pending := r.references[r.sent:]
+	r.sent = len(r.references)
+
+	return pending
+}
+
+// documentReference builds the reference of a retrieved chunk. Chunks of the
+// same file share one reference, which links to the first retrieved chunk.
+func documentReference(doc retrieval.Result) sseReference {
+	reference := resultReference(doc)
+
+	return sseReference{
+		Type: "document",
+		ID:   reference.ID,
+		Metadata: sseReferenceMetadata{
+			DisplayName: reference.DisplayName,
+			DisplayIcon: "icon",
+			DisplayURL:  reference.URL,
+		},
+	}
+}
+
+// resultReference builds the reference of a retrieved chunk from the link
+// metadata stored at index time.
+func resultReference(doc retrieval.Result) Reference {
+	id := doc.Metadata["file"]
+	if id == "" {
+		id = doc.ID
+	}
+
+	link := doc.Metadata["url"]
+	if link == "" {
+		link = "unknown"
+	}
+
+	displayName := doc.Metadata["title"]
+	if displayName == "" {
+		displayName = doc.Metadata["path"]
+	}
+	if displayName == "" {
+		displayName = id
+	}
+
+	return Reference{
+		ID:          id,
+		DisplayName: displayName,
+		URL:         link,
+	}
+}
+
+// toolReferences converts the references of a tool result.
+func toolReferences(references []Reference) []sseReference {
+	converted := make([]sseReference, 0, len(references))
+
+	for _, reference := range references {
+		converted = append(converted, sseReference{
+			Type: "link",
+			ID:   reference.ID,
+			Metadata: sseReferenceMetadata{
+				DisplayName: reference.DisplayName,
+				DisplayIcon: "icon",
+				DisplayURL:  reference.URL,
+			},
+		})
+	}
+
+	return converted
+}
@@ -0,0 +1,227 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/invopop/jsonschema"
+	"github.com/shopwarelabs/copilot-extension/copilot"
+)
+
+// Tool is a function the model can call while answering. Implement it to add
+// tools to the agent without changing this package.
+type Tool interface {
+	// Name identifies the tool towards the model
+	Name() string
+
+	// Description tells the model when to use the tool
+	Description() string
+
+	// Parameters is the JSON schema of the arguments, nil if the tool takes
+	// none
+	Parameters() *jsonschema.Schema
+
+	// Execute runs the tool with the JSON encoded arguments chosen by the model
+	Execute(ctx context.Context, arguments string) (*ToolResult, error)
+}
+
+// ToolResult is the outcome of a tool call.
+type ToolResult struct {
+	// Content is passed to the model
+	Content string
+
+	// References are shown to the user as sources of the answer
+	References []Reference
+}
+
+// Reference is a page a tool consulted.
+type Reference struct {
+	ID          string
+	DisplayName string
+	URL         string
+}
+
+// Registry holds the tools offered to the model.
+type Registry struct {
+	tools []Tool
+}
+
+// NewRegistry creates a registry with the given tools.
+func NewRegistry(tools ...Tool) (*Registry, error) {
+	r := &Registry{}
+
+	for _, tool := range tools {
+		if err := r.Register(tool); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Register adds a tool. Tool names have to be unique.
+func (r *Registry) Register(tool Tool) error {
+	if _, ok := r.Get(tool.Name()); ok {
+		return fmt.Errorf("tool %s is already registered", tool.Name())
+	}
+
+	r.tools = append(r.tools, tool)
+
+	return nil
+}
+
+// Get returns the tool with the given name.
+func (r *Registry) Get(name string) (Tool, bool) {
+	for _, tool := range r.tools {
+		if tool.Name() == name {
+			return tool, true
+		}
+	}
+
+	return nil, false
+}
+
+// Filter returns a registry with the tools of this deployment. When enabled is
+// not empty only the listed tools are kept, tools listed in disabled are
+// removed. Unknown names are reported as error to catch typos in the config.
+func (r *Registry) Filter(enabled, disabled []string) (*Registry, error) {
+	for _, name := range slices.Concat(enabled, disabled) {
+		if _, ok := r.Get(name); !ok {
+			return nil, fmt.Errorf("unknown tool: %s", name)
+		}
+	}
+
+	filtered := &Registry{}
+
+	for _, tool := range r.tools {
+		if len(enabled) > 0 && !slices.Contains(enabled, tool.Name()) {
+			continue
+		}
+
+		if slices.Contains(disabled, tool.Name()) {
+			continue
+		}
+
+		filtered.tools = append(filtered.tools, tool)
+	}
+
+	return filtered, nil
+}
+
+// Definitions returns the function definitions sent to the model.
+func (r *Registry) Definitions() []copilot.FunctionTool {
+	definitions := make([]copilot.FunctionTool, 0, len(r.tools))
+
+	for _, tool := range r.tools {
+		definitions = append(definitions, copilot.FunctionTool{
+			Type: "function",
+			Function: copilot.Function{
+				Name:        tool.Name(),
+				Description: tool.Description(),
+				Parameters:  tool.Parameters(),
+			},
+		})
+	}
+
+	return definitions
+}
+
+// Execute runs the tool requested by the model.
+func (r *Registry) Execute(ctx context.Context, function *copilot.ChatMessageFunctionCall) (*ToolResult, error) {
+	tool, ok := r.Get(function.Name)
+	if !ok {
+		return nil, fmt.Errorf("unknown function: %s", function.Name)
+	}
+
+	return tool.Execute(ctx, function.Arguments)
+}
+
+// ToolTimeout can be implemented by tools which need a different timeout than
+// the default of the service.
+type ToolTimeout interface {
+	Timeout() time.Duration
+}
+
+// toolOutcome is the result or the error of a single tool call.
+type toolOutcome struct {
+	call   *copilot.ToolCall
+	result *ToolResult
+	err    error
+}
+
+// executeAll runs the requested tools concurrently, each bound by its
+// timeout. The outcomes are returned in the order of the calls. A failing tool
+// does not affect the others.
+func (r *Registry) executeAll(ctx context.Context, calls []*copilot.ToolCall, timeout time.Duration) []toolOutcome {
+	outcomes := make([]toolOutcome, len(calls))
+
+	var wg sync.WaitGroup
+
+	for i, call := range calls {
+		outcomes[i].call = call
+		function := call.Function
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// The handler goroutine's recovery doesn't cover this goroutine, a
+			// panicking tool would stop the server
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					log.Error("tool panicked", "tool", function.Name, "panic", recovered, "stack", string(debug.Stack()))
+					outcomes[i].result = nil
+					outcomes[i].err = fmt.Errorf("tool %s failed unexpectedly", function.Name)
+				}
+			}()
+
+			toolTimeout := timeout
+			if tool, ok := r.Get(function.Name); ok {
+				if custom, ok := tool.(ToolTimeout); ok {
+					toolTimeout = custom.Timeout()
+				}
+			}
+
+			toolCtx, cancel := context.WithTimeout(ctx, toolTimeout)
+			defer cancel()
+
+			outcomes[i].result, outcomes[i].err = r.Execute(toolCtx, function)
+
+			if outcomes[i].err == nil && toolCtx.Err() != nil {
+				outcomes[i].err = toolCtx.Err()
+			}
+
+			if errors.Is(outcomes[i].err, context.DeadlineExceeded) {
+				outcomes[i].err = fmt.Errorf("timed out after %s", toolTimeout)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return outcomes
+}
+
+// callKey identifies a function call by its name and arguments, ignoring the
+// formatting of the arguments.
+func callKey(function *copilot.ChatMessageFunctionCall) string {
+	var arguments any
+	if err := json.Unmarshal([]byte(function.Arguments), &arguments); err != nil {
+		return function.Name + ":" + function.Arguments
+	}
+
+	// Maps are marshalled with sorted keys
+	normalized, err := json.Marshal(arguments)
+	if err != nil {
+		return function.Name + ":" + function.Arguments
+	}
+
+	return function.Name + ":" + string(normalized)
+}
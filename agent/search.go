@@ -5,22 +5,23 @@ import (
 	"net/http"
 	"strconv"
 
-	"github.com/philippgille/chromem-go"
+	"github.com/shopwarelabs/copilot-extension/retrieval"
 )
 
 type SearchService struct {
-	collection *chromem.Collection
+	retriever *retrieval.Retriever
 }
 
-func NewSearchService(collection *chromem.Collection) *SearchService {
+func NewSearchService(retriever *retrieval.Retriever) *SearchService {
 	return &SearchService{
-		collection: collection,
+		retriever: retriever,
 	}
 }
 
 type SearchResult struct {
 	ID         string  `json:"id"`
 	Similarity float32 `json:"similarity"`
+	Score      float64 `json:"score"`
 	Content    string  `json:"content"`
 }
 
@@ -44,10 +45,10 @@ func (s *SearchService) Search(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Perform the search using the collection
-	results, err := s.collection.Query(r.Context(), query, limitInt, map[string]string{
+	// Perform the hybrid search using the retriever
+	results, err := s.retriever.Query(r.Context(), query, limitInt, map[string]string{
 		"source": "docs",
-	}, nil)
+	})
 	if err != nil {
 		http.Error(w, "Error performing search: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -59,6 +60,7 @@ func (s *SearchService) Search(w http.ResponseWriter, r *http.Request) {
 		searchResults = append(searchResults, SearchResult{
 			ID:         result.ID,
 			Similarity: result.Similarity,
+			Score:      result.Score,
 			Content:    result.Content,
 		})
 	}
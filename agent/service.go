@@ -2,40 +2,137 @@ package agent
 
 import (
 	"context"
-	"crypto/ecdsa"
-	"crypto/sha256"
-	"encoding/asn1"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"math/big"
+	"maps"
 	"net/http"
-	"regexp"
-	"strings"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/charmbracelet/log"
-	"github.com/hashicorp/go-retryablehttp"
-	"github.com/philippgille/chromem-go"
 	"github.com/shopwarelabs/copilot-extension/copilot"
+	"github.com/shopwarelabs/copilot-extension/retrieval"
+	"github.com/shopwarelabs/copilot-extension/signature"
 )
 
-var fileRegexp = regexp.MustCompile(`(?m)^(.*\.\w+)_\d+$`)
+const (
+	defaultToolTimeout    = 30 * time.Second
+	defaultMaxToolRounds  = 5
+	defaultRetrievalLimit = 5
+
+	// keepAliveInterval is how often a comment is sent to the client while the
+	// agent waits for tools
+	keepAliveInterval = 10 * time.Second
+)
 
 // Service provides and endpoint for this agent to perform chat completions
 type Service struct {
-	pubKey     *ecdsa.PublicKey
-	collection *chromem.Collection
-	debugMode  bool
+	verifier  *signature.Verifier
+	retriever *retrieval.Retriever
+	provider  copilot.Provider
+	tools     *Registry
+	options   Options
 }
 
-func NewService(pubKey *ecdsa.PublicKey, collection *chromem.Collection, debugMode bool) *Service {
+// Options configure the behaviour of the agent.
+type Options struct {
+	// Model is the chat model used when the request doesn't ask for one
+	Model copilot.Model
+
+	// AllowedModels are the models a request may ask for instead of Model
+	AllowedModels []copilot.Model
+
+	// RetrievalLimit is the number of documents retrieved up front
+	RetrievalLimit int
+
+	// QueryTurns is the number of recent user messages the retrieval query is
+	// built from
+	QueryTurns int
+
+	// QueryRewrite lets the model rewrite follow-up questions into a
+	// standalone retrieval query
+	QueryRewrite bool
+
+	// ContextTokens is the context window of the chat model
+	ContextTokens int
+
+	// ResponseTokens are reserved in the context window for the answer
+	ResponseTokens int
+
+	// ToolTokens are reserved in the context window for tool results, a
+	// single result may use a quarter of them
+	ToolTokens int
+
+	// ToolTimeout limits the runtime of a single tool call
+	ToolTimeout time.Duration
+
+	// UpfrontRetrieval adds the documents matching the conversation to the
+	// prompt before the model is asked. Without it, the model has to use the
+	// search_docs tool to look up documents.
+	UpfrontRetrieval bool
+
+	// MaxToolRounds limits how often the model may call tools before it has
+	// to answer
+	MaxToolRounds int
+}
+
+func NewService(verifier *signature.Verifier, retriever *retrieval.Retriever, provider copilot.Provider, tools *Registry, options Options) *Service {
 	return &Service{
-		pubKey:     pubKey,
-		collection: collection,
-		debugMode:  debugMode,
+		verifier:  verifier,
+		retriever: retriever,
+		provider:  provider,
+		tools:     tools,
+		options:   options,
+	}
+}
+
+func (s *Service) toolTimeout() time.Duration {
+	if s.options.ToolTimeout <= 0 {
+		return defaultToolTimeout
 	}
+
+	return s.options.ToolTimeout
+}
+
+// model returns the model requested by the client if it is allowed, the
+// configured model otherwise.
+func (s *Service) model(req *copilot.ChatRequest) copilot.Model {
+	if req.Model != "" && slices.Contains(s.options.AllowedModels, req.Model) {
+		return req.Model
+	}
+
+	if req.Model != "" {
+		log.Debugf("Ignoring model %s requested by the client", req.Model)
+	}
+
+	return s.defaultModel()
+}
+
+func (s *Service) defaultModel() copilot.Model {
+	if s.options.Model == "" {
+		return copilot.ModelGPT4
+	}
+
+	return s.options.Model
+}
+
+func (s *Service) retrievalLimit() int {
+	if s.options.RetrievalLimit <= 0 {
+		return defaultRetrievalLimit
+	}
+
+	return s.options.RetrievalLimit
+}
+
+func (s *Service) maxToolRounds() int {
+	if s.options.MaxToolRounds <= 0 {
+		return defaultMaxToolRounds
+	}
+
+	return s.options.MaxToolRounds
 }
 
 func (s *Service) ChatCompletion(w http.ResponseWriter, r *http.Request) {
@@ -48,26 +145,22 @@ func (s *Service) ChatCompletion(w http.ResponseWriter, r *http.Request) {
 
 	// Make sure the payload matches the signature. In this way, you can be sure
 	// that an incoming request comes from github
-	if !s.debugMode {
-		isValid, err := validPayload(body, r.Header.Get("Github-Public-Key-Signature"), s.pubKey)
-		if err != nil {
-			log.Infof("failed to validate payload signature: %v\n", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		if !isValid {
-			http.Error(w, "invalid payload signature", http.StatusUnauthorized)
-			return
-		}
+	err = s.verifier.Verify(r.Context(), body, r.Header.Get("Github-Public-Key-Signature"), r.Header.Get("Github-Public-Key-Identifier"))
+	if errors.Is(err, signature.ErrInvalidSignature) || errors.Is(err, signature.ErrUnknownKey) {
+		log.Infof("rejected request: %v", err)
+		http.Error(w, "invalid payload signature", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Errorf("failed to validate payload signature: %v", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
 	}
 
 	apiToken := r.Header.Get("X-GitHub-Token")
 	integrationID := r.Header.Get("Copilot-Integration-Id")
 
-	if s.debugMode {
-		log.Infof("Integration ID: %s", integrationID)
-		log.Infof("API Token: %s", apiToken)
-	}
+	log.Debug("Received request", "integration_id", integrationID)
 
 	var req *copilot.ChatRequest
 	if err := json.Unmarshal(body, &req); err != nil {
@@ -76,143 +169,291 @@ func (s *Service) ChatCompletion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.generateCompletion(r.Context(), integrationID, apiToken, req, NewSSEWriter(w)); err != nil {
-		log.Infof("failed to execute agent: %v", err)
-	}
-}
+	// Cancelled when the client is gone, which stops the upstream request and
+	// running tools
+	ctx, cancel := context.WithCancelCause(r.Context())
+	defer cancel(nil)
 
-func (s *Service) generateCompletion(ctx context.Context, integrationID, apiToken string, req *copilot.ChatRequest, w *sseWriter) error {
-	var messages []copilot.ChatMessage
-	copilotReferences := []sseReference{}
+	sse := NewSSEWriter(w, cancel)
 
-	messages = append(messages, req.Messages...)
+	if err := s.generateCompletion(ctx, integrationID, apiToken, req, sse); err != nil {
+		log.Errorf("failed to execute agent: %v", err)
 
-	loopAgainForTool := false
-
-	functionCalls := make(map[int]*copilot.ChatMessageFunctionCall)
+		if ctx.Err() != nil {
+			return
+		}
 
-	// Create embeddings from user messages
-	for i := len(req.Messages) - 1; i >= 0; i++ {
-		msg := req.Messages[i]
-		if msg.Role != "user" {
-			continue
+		if err := sse.writeErrors([]sseError{completionError(err)}); err != nil {
+			log.Errorf("failed to write error: %v", err)
+			return
 		}
 
-		// Filter empty messages
-		if msg.Content == "" {
-			continue
+		if err := sse.writeDone(); err != nil {
+			log.Errorf("failed to write done: %v", err)
 		}
+	}
+}
 
-		startTime := time.Now()
+// completionError converts an error of the agent into the error shown to the
+// user. Errors of the chat API are passed on, other errors are not as they
+// may contain internal details.
+func completionError(err error) sseError {
+	var streamErr *copilot.StreamError
+	if errors.As(err, &streamErr) {
+		code := streamErr.Code
+		if code == "" {
+			code = "stream_error"
+		}
 
-		res, err := s.collection.Query(ctx, msg.Content, 5, nil, nil)
+		return sseError{
+			Type:       "agent",
+			Code:       code,
+			Message:    streamErr.Message,
+			Identifier: "chat_api",
+		}
+	}
 
-		if err != nil {
-			return fmt.Errorf("failed to query collection: %w", err)
+	var apiErr *copilot.APIError
+	if !errors.As(err, &apiErr) {
+		return sseError{
+			Type:       "agent",
+			Code:       "internal_error",
+			Message:    "Something went wrong while answering, please try again.",
+			Identifier: "agent",
 		}
+	}
+
+	code := apiErr.Code
+	if code == "" {
+		code = strconv.Itoa(apiErr.StatusCode)
+	}
 
-		log.Infof("Query took %s", time.Since(startTime))
+	message := apiErr.Message
+	if apiErr.StatusCode == http.StatusTooManyRequests {
+		message = "The rate limit of the chat API was reached, please try again later. " + message
+	}
 
-		contextMessage := ""
+	return sseError{
+		Type:       "agent",
+		Code:       code,
+		Message:    message,
+		Identifier: "chat_api",
+	}
+}
 
-		for _, doc := range res {
-			link := "unknown"
-			fileName := doc.ID
+const systemPrompt = "You are a specialized technical chatbot for Shopware 6 development. Your primary goal is to assist developers with precise and accurate technical information about Shopware 6. Always provide detailed, developer-focused responses that cover both theoretical concepts and practical implementation. When asked, generate relevant code examples and explain them thoroughly, including best practices for Shopware 6 development. Your knowledge is based on the provided Shopware 6 documentation and code examples. If you're unsure about something, admit it and suggest where the user might find more information. Respond in a clear, concise, and technical manner suitable for developers. Use proper formatting for code snippets and technical terms. When explaining concepts, break them down into easily understandable parts. If providing step-by-step instructions, number them clearly. Always strive for accuracy and completeness in your responses. If a question is ambiguous, ask for clarification to ensure you provide the most relevant information.\n"
+
+func (s *Service) generateCompletion(ctx context.Context, integrationID, apiToken string, req *copilot.ChatRequest, w *sseWriter) error {
+	var messages []copilot.ChatMessage
+	references := newReferenceSet()
+	model := s.model(req)
+	budget := s.newTokenBudget(model)
+
+	// The conversation may use up to half of the prompt budget, the remainder
+	// is left for the retrieved documents
+	budget.reserve(systemPrompt)
+	messages = append(messages, s.packHistory(ctx, integrationID, apiToken, budget, req.Messages, budget.prompt/2)...)
+
+	loopAgainForTool := false
 
-			if strings.HasPrefix(doc.ID, "data/docs/") {
-				fileName = fileRegexp.FindStringSubmatch(strings.TrimPrefix(doc.ID, "data/docs/"))[1]
+	toolCalls := make(map[int]*copilot.ToolCall)
 
-				link = fmt.Sprintf("https://github.com/shopware/docs/blob/main/%s", fileName)
-			} else if strings.HasPrefix(doc.ID, "data/src/") {
-				fileName = fileRegexp.FindStringSubmatch(strings.TrimPrefix(doc.ID, "data/"))[1]
+	prompt := systemPrompt
 
-				link = fmt.Sprintf("https://github.com/shopware/shopware/blob/trunk/%s", fileName)
+	// Retrieve documents matching the conversation
+	if s.options.UpfrontRetrieval {
+		if query := s.retrievalQuery(ctx, integrationID, apiToken, req.Messages); query != "" {
+			startTime := time.Now()
+
+			res, err := s.retriever.Query(ctx, query, s.retrievalLimit(), nil)
+
+			if err != nil {
+				return fmt.Errorf("failed to retrieve documents: %w", err)
 			}
 
-			copilotReferences = append(copilotReferences, sseReference{
-				Type: "document",
-				ID:   doc.ID,
-				Metadata: sseReferenceMetadata{
-					DisplayName: fileName,
-					DisplayIcon: "icon",
-					DisplayURL:  link,
-				},
-			})
+			log.Infof("Query took %s", time.Since(startTime))
 
-			contextMessage += doc.Content + "\n"
-		}
+			contextMessage := ""
 
-		messages = append(messages, copilot.ChatMessage{
-			Role: "system",
-			Content: "You are a specialized technical chatbot for Shopware 6 development. Your primary goal is to assist developers with precise and accurate technical information about Shopware 6. Always provide detailed, developer-focused responses that cover both theoretical concepts and practical implementation. When asked, generate relevant code examples and explain them thoroughly, including best practices for Shopware 6 development. Your knowledge is based on the provided Shopware 6 documentation and code examples. If you're unsure about something, admit it and suggest where the user might find more information. Respond in a clear, concise, and technical manner suitable for developers. Use proper formatting for code snippets and technical terms. When explaining concepts, break them down into easily understandable parts. If providing step-by-step instructions, number them clearly. Always strive for accuracy and completeness in your responses. If a question is ambiguous, ask for clarification to ensure you provide the most relevant information.\n" +
-				"Context: " + contextMessage + "\nWhen calling get_store_extension pass all app/plugin/extension names",
-		})
+			for _, doc := range packContext(budget, res) {
+				references.add(documentReference(doc))
 
-		break
+				contextMessage += doc.Content + "\n"
+			}
+
+			prompt += "Context: " + contextMessage + "\n"
+		}
+	} else if _, ok := s.tools.Get("search_docs"); ok {
+		hint := "Use search_docs to look up the documentation and source code before answering, search again with other queries when the results don't answer the question.\n"
+		budget.reserve(hint)
+		prompt += hint
 	}
 
-	usedTools := []string{}
+	// Without up-front retrieval the documents arrive as tool results
+	budget.startTools(!s.options.UpfrontRetrieval)
+
+	messages = append(messages, copilot.ChatMessage{
+		Role:    "system",
+		Content: prompt + "When calling get_store_extension pass all app/plugin/extension names",
+	})
+
+	// Results of the calls made so far, the model gets them again instead of
+	// executing an identical call twice
+	previousCalls := make(map[string]string)
+	finish := &finishState{}
+	toolRounds := 0
+	toolsExhausted := false
 
 	for {
 		startTime := time.Now()
 		chatReq := &copilot.ChatCompletionsRequest{
-			Model:    copilot.ModelGPT4,
+			Model:    model,
 			Messages: messages,
-			Tools:    tools.RemoveTool(usedTools),
 			Stream:   true,
 		}
 
-		stream, err := copilot.StreamChatCompletions(ctx, retryablehttp.NewClient(), integrationID, apiToken, chatReq)
+		if toolsExhausted {
+			chatReq.Messages = append(slices.Clone(messages), copilot.ChatMessage{
+				Role:    "system",
+				Content: "No more functions can be called. Answer the question with the information gathered so far and mention if it is incomplete.",
+			})
+		} else {
+			chatReq.Tools = s.tools.Definitions()
+		}
+
+		// Stops the stream when the loop leaves it early for tool calls
+		streamCtx, cancelStream := context.WithCancel(ctx)
+
+		stream, err := s.provider.StreamChatCompletions(streamCtx, copilot.Credentials{IntegrationID: integrationID, APIKey: apiToken}, chatReq)
 		if err != nil {
+			cancelStream()
 			return fmt.Errorf("failed to get chat completions stream: %w", err)
 		}
 
 		for streamResp := range stream {
 			if streamResp.Error != nil {
+				cancelStream()
 				return fmt.Errorf("stream error: %w", streamResp.Error)
 			}
 
 			if isFunctionCall(streamResp.Response) {
 				if len(streamResp.Response.Choices[0].Delta.ToolCalls) > 0 {
 					for _, toolCall := range streamResp.Response.Choices[0].Delta.ToolCalls {
-						if _, ok := functionCalls[toolCall.Index]; !ok {
-							functionCalls[toolCall.Index] = &copilot.ChatMessageFunctionCall{
-								Name:      "",
-								Arguments: "",
+						if _, ok := toolCalls[toolCall.Index]; !ok {
+							toolCalls[toolCall.Index] = &copilot.ToolCall{
+								Type:     "function",
+								Function: &copilot.ChatMessageFunctionCall{},
 							}
 						}
 
-						tmp := functionCalls[toolCall.Index]
+						tmp := toolCalls[toolCall.Index]
+
+						if toolCall.ID != "" {
+							tmp.ID = toolCall.ID
+						}
+
+						if toolCall.Type != "" {
+							tmp.Type = toolCall.Type
+						}
+
+						if toolCall.Function == nil {
+							continue
+						}
 
 						if toolCall.Function.Name != "" {
-							tmp.Name = tmp.Name + toolCall.Function.Name
+							tmp.Function.Name = tmp.Function.Name + toolCall.Function.Name
 						}
 
 						if toolCall.Function.Arguments != "" {
-							tmp.Arguments = tmp.Arguments + toolCall.Function.Arguments
+							tmp.Function.Arguments = tmp.Function.Arguments + toolCall.Function.Arguments
 						}
 					}
 				}
 
 				if streamResp.Response.Choices[0].FinishReason == "tool_calls" {
-					for _, function := range functionCalls {
-						usedTools = append(usedTools, function.Name)
-						log.Infof("Function CALL: %s", function.Name)
+					finishReasons.Add("tool_calls", 1)
+
+					// Keep the order the model requested the calls in
+					indexes := slices.Sorted(maps.Keys(toolCalls))
+					calls := make([]*copilot.ToolCall, 0, len(indexes))
 
-						msg, err := handleFunction(ctx, function)
+					for _, index := range indexes {
+						call := toolCalls[index]
+						if call.ID == "" {
+							call.ID = fmt.Sprintf("call_%d", index)
+						}
+
+						calls = append(calls, call)
+						log.Infof("Function CALL: %s", call.Function.Name)
+					}
 
-						if err != nil {
-							w.writeEvent("copilot_errors")
-							w.writeData([]sseError{{Type: "function", Code: "failed", Message: err.Error(), Identifier: function.Name}})
-							w.writeDone()
+					// The assistant message requesting the calls has to precede
+					// their results
+					messages = append(messages, copilot.ChatMessage{
+						Role:      "assistant",
+						ToolCalls: calls,
+					})
 
-							return fmt.Errorf("failed to handle function: %w", err)
+					toolRounds++
+
+					var pending []*copilot.ToolCall
+					for _, call := range calls {
+						key := callKey(call.Function)
+						content, repeated := previousCalls[key]
+
+						if !repeated {
+							pending = append(pending, call)
+							continue
+						}
+
+						log.Infof("Repeated function call: %s", call.Function.Name)
+
+						msg := copilot.ChatMessage{
+							Role:       "tool",
+							ToolCallID: call.ID,
+							Content:    "This function was already called with the same arguments, the result was:\n" + content,
 						}
 
-						messages = append(messages, *msg)
+						packToolResult(budget, &msg)
+						messages = append(messages, msg)
 					}
 
-					functionCalls = make(map[int]*copilot.ChatMessageFunctionCall)
+					// A round with only repeated calls will not lead anywhere new
+					if len(pending) == 0 || toolRounds >= s.maxToolRounds() {
+						toolsExhausted = true
+					}
+
+					stopKeepAlive := w.keepAlive(keepAliveInterval)
+					outcomes := s.tools.executeAll(ctx, pending, s.toolTimeout())
+					stopKeepAlive()
+
+					if ctx.Err() != nil {
+						cancelStream()
+						return context.Cause(ctx)
+					}
+
+					for _, outcome := range outcomes {
+						msg := copilot.ChatMessage{
+							Role:       "tool",
+							ToolCallID: outcome.call.ID,
+						}
+
+						// A failing tool is reported to the model, which can still
+						// answer with the results of the other tools
+						if outcome.err != nil {
+							log.Errorf("function %s failed: %v", outcome.call.Function.Name, outcome.err)
+							msg.Content = fmt.Sprintf("The function %s failed: %v", outcome.call.Function.Name, outcome.err)
+						} else {
+							msg.Content = outcome.result.Content
+							previousCalls[callKey(outcome.call.Function)] = outcome.result.Content
+							references.add(toolReferences(outcome.result.References)...)
+						}
+
+						packToolResult(budget, &msg)
+						messages = append(messages, msg)
+					}
+
+					toolCalls = make(map[int]*copilot.ToolCall)
 
 					log.Infof("Responded function call")
 
@@ -222,9 +463,18 @@ func (s *Service) generateCompletion(ctx context.Context, integrationID, apiToke
 				}
 			} else {
 				if len(streamResp.Response.Choices) > 0 {
+					// References have to arrive before the content they belong to
+					if pending := references.pending(); len(pending) > 0 {
+						if err := w.writeReferences(pending); err != nil {
+							cancelStream()
+							return fmt.Errorf("failed to write references: %w", err)
+						}
+					}
 
 					choices := make([]sseResponseChoice, len(streamResp.Response.Choices))
 					for i, choice := range streamResp.Response.Choices {
+						finish.observe(choice)
+
 						choices[i] = sseResponseChoice{
 							Index: choice.Index,
 							Delta: sseResponseMessage{
@@ -234,19 +484,30 @@ func (s *Service) generateCompletion(ctx context.Context, integrationID, apiToke
 						}
 					}
 
-					w.writeData(sseResponse{
+					if err := w.writeData(sseResponse{
 						Choices: choices,
-					})
+					}); err != nil {
+						cancelStream()
+						return err
+					}
 				}
 			}
 		}
 
+		cancelStream()
+
 		if loopAgainForTool {
 			loopAgainForTool = false
 			continue
 		}
 
-		w.writeDone()
+		if err := finish.write(w); err != nil {
+			return err
+		}
+
+		if err := w.writeDone(); err != nil {
+			return err
+		}
 
 		log.Infof("Copilot API took %s", time.Since(startTime))
 		break
@@ -255,28 +516,6 @@ func (s *Service) generateCompletion(ctx context.Context, integrationID, apiToke
 	return nil
 }
 
-// asn1Signature is a struct for ASN.1 serializing/parsing signatures.
-type asn1Signature struct {
-	R *big.Int
-	S *big.Int
-}
-
-func validPayload(data []byte, sig string, publicKey *ecdsa.PublicKey) (bool, error) {
-	asnSig, err := base64.StdEncoding.DecodeString(sig)
-	parsedSig := asn1Signature{}
-	if err != nil {
-		return false, err
-	}
-	rest, err := asn1.Unmarshal(asnSig, &parsedSig)
-	if err != nil || len(rest) != 0 {
-		return false, err
-	}
-
-	// Verify the SHA256 encoded payload against the signature with GitHub's Key
-	digest := sha256.Sum256(data)
-	return ecdsa.Verify(publicKey, digest[:], parsedSig.R, parsedSig.S), nil
-}
-
 func isFunctionCall(res *copilot.ChatCompletionsResponse) bool {
 	if len(res.Choices) == 0 {
 		return false
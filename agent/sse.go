@@ -1,49 +1,141 @@
 package agent
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"io"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
 )
 
 // Copilot extensions must stream back chat responses. sseWriter wraps an
-// io.Writer to help write sse formated data.
+// http.ResponseWriter to help write sse formated data. Every event is flushed
+// right away. Once a write fails, e.g. because the client disconnected, the
+// context of the answer is cancelled and all further writes fail.
 type sseWriter struct {
-	w io.Writer
+	mu     sync.Mutex
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	cancel context.CancelCauseFunc
+	err    error
 }
 
-func NewSSEWriter(w io.Writer) *sseWriter {
+// NewSSEWriter sets the event stream headers on w. cancel is called with the
+// error of the first failed write.
+func NewSSEWriter(w http.ResponseWriter, cancel context.CancelCauseFunc) *sseWriter {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
 	return &sseWriter{
-		w: w,
+		w:      w,
+		rc:     http.NewResponseController(w),
+		cancel: cancel,
 	}
 }
 
-// writeSSEDone writes a [DONE] SSE message to the writer.
-func (w *sseWriter) writeDone() {
-	_, _ = w.w.Write([]byte("data: [DONE]\n\n"))
-}
+// write sends a complete frame to the client and flushes it.
+func (w *sseWriter) write(frame []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-// writeSSEData writes a data SSE message to the writer.
-func (w *sseWriter) writeData(v any) error {
-	_, _ = w.w.Write([]byte("data: "))
-	if err := json.NewEncoder(w.w).Encode(v); err != nil {
-		return err
+	if w.err != nil {
+		return w.err
+	}
+
+	if _, err := w.w.Write(frame); err != nil {
+		return w.fail(err)
+	}
+
+	if err := w.rc.Flush(); err != nil {
+		return w.fail(err)
 	}
 
-	_, _ = w.w.Write([]byte("\n")) // Encode() adds one newline, so add only one more here.
 	return nil
 }
 
-// writeSSEEvent writes a data SSE message to the writer.
-func (w *sseWriter) writeEvent(name string) error {
-	_, err := w.w.Write([]byte("event: " + name))
-	if err != nil {
-		return err
+func (w *sseWriter) fail(err error) error {
+	w.err = fmt.Errorf("failed to write to client: %w", err)
+
+	if w.cancel != nil {
+		w.cancel(w.err)
 	}
-	_, err = w.w.Write([]byte("\n"))
-	if err != nil {
+
+	return w.err
+}
+
+// writeDone writes a [DONE] SSE message to the writer.
+func (w *sseWriter) writeDone() error {
+	return w.write([]byte("data: [DONE]\n\n"))
+}
+
+// writeData writes a data SSE message to the writer.
+func (w *sseWriter) writeData(v any) error {
+	return w.writeEvent("", v)
+}
+
+// writeEvent writes a data SSE message with the event name to the writer, the
+// default event when the name is empty.
+func (w *sseWriter) writeEvent(name string, v any) error {
+	var frame bytes.Buffer
+
+	if name != "" {
+		frame.WriteString("event: " + name + "\n")
+	}
+
+	frame.WriteString("data: ")
+	if err := json.NewEncoder(&frame).Encode(v); err != nil {
 		return err
 	}
-	return nil
+
+	frame.WriteString("\n") // Encode() adds one newline, so add only one more here.
+
+	return w.write(frame.Bytes())
+}
+
+// keepAlive writes a comment every interval until the returned function is
+// called, so clients and proxies don't close the connection while the agent
+// is busy, e.g. with tool calls.
+func (w *sseWriter) keepAlive(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := w.write([]byte(": keep-alive\n\n")); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// writeReferences writes a copilot_references event, which Copilot Chat shows
+// as the sources of the answer.
+func (w *sseWriter) writeReferences(references []sseReference) error {
+	return w.writeEvent("copilot_references", references)
+}
+
+// writeErrors writes a copilot_errors event, which Copilot Chat shows to the
+// user instead of a broken answer.
+func (w *sseWriter) writeErrors(errors []sseError) error {
+	return w.writeEvent("copilot_errors", errors)
 }
 
 type sseResponse struct {
@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+	"github.com/shopwarelabs/copilot-extension/retrieval"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+const (
+	defaultSearchLimit = 5
+	maxSearchLimit     = 10
+)
+
+// searchDocsTool lets the model search the indexed documentation and code
+// itself, so it can look up several topics while answering.
+type searchDocsTool struct {
+	retriever *retrieval.Retriever
+	sources   []string
+}
+
+// NewSearchDocsTool creates the search_docs tool. sources are the names of the
+// indexed sources the model can restrict a search to.
+func NewSearchDocsTool(retriever *retrieval.Retriever, sources []string) Tool {
+	return searchDocsTool{
+		retriever: retriever,
+		sources:   sources,
+	}
+}
+
+func (searchDocsTool) Name() string {
+	return "search_docs"
+}
+
+func (searchDocsTool) Description() string {
+	return "Search the Shopware 6 documentation and source code. Call it multiple times with specific queries to look up different topics"
+}
+
+func (t searchDocsTool) Parameters() *jsonschema.Schema {
+	properties := orderedmap.New[string, *jsonschema.Schema]()
+	properties.Set("query", &jsonschema.Schema{
+		Type:        "string",
+		Description: "What to search for, e.g. a concept, class name or configuration key",
+	})
+
+	source := &jsonschema.Schema{
+		Type:        "string",
+		Description: "Only search in this source, all sources when empty",
+	}
+
+	for _, name := range t.sources {
+		source.Enum = append(source.Enum, name)
+	}
+
+	properties.Set("source", source)
+	properties.Set("limit", &jsonschema.Schema{
+		Type:        "integer",
+		Description: fmt.Sprintf("Number of results, %d when empty", defaultSearchLimit),
+		Minimum:     json.Number("1"),
+		Maximum:     json.Number(fmt.Sprint(maxSearchLimit)),
+	})
+
+	return &jsonschema.Schema{
+		Type:       "object",
+		Properties: properties,
+		Required:   []string{"query"},
+	}
+}
+
+func (t searchDocsTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var parameters struct {
+		Query  string `json:"query"`
+		Source string `json:"source"`
+		Limit  int    `json:"limit"`
+	}
+
+	if err := json.Unmarshal([]byte(arguments), &parameters); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+
+	if strings.TrimSpace(parameters.Query) == "" {
+		return nil, fmt.Errorf("query must not be empty")
+	}
+
+	limit := parameters.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+
+	var where map[string]string
+	if parameters.Source != "" {
+		where = map[string]string{"source": parameters.Source}
+	}
+
+	results, err := t.retriever.Query(ctx, parameters.Query, limit, where)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to search documents: %w", err)
+	}
+
+	if len(results) == 0 {
+		return &ToolResult{Content: "No documents found"}, nil
+	}
+
+	var content strings.Builder
+	references := make([]Reference, 0, len(results))
+
+	for _, result := range results {
+		reference := resultReference(result)
+		references = append(references, reference)
+
+		fmt.Fprintf(&content, "Document: %s\nURL: %s\n\n%s\n\n", reference.DisplayName, reference.URL, result.Content)
+	}
+
+	return &ToolResult{
+		Content:    content.String(),
+		References: references,
+	}, nil
+}
@@ -7,119 +7,58 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"slices"
 	"strings"
 	"sync"
 
 	"github.com/charmbracelet/log"
 	"github.com/invopop/jsonschema"
-	"github.com/shopwarelabs/copilot-extension/copilot"
 	orderedmap "github.com/wk8/go-ordered-map/v2"
 )
 
-type Tools []copilot.FunctionTool
-
-func (t Tools) RemoveTool(name []string) Tools {
-	scopedTools := make(Tools, 0)
-
-	for _, tool := range t {
-		if !slices.Contains(name, tool.Function.Name) {
-			scopedTools = append(scopedTools, tool)
-		}
+// DefaultTools returns the tools shipped with the agent.
+func DefaultTools() []Tool {
+	return []Tool{
+		&shopwareVersionsTool{},
+		releaseNotesTool{},
+		storeExtensionTool{},
 	}
-
-	return scopedTools
 }
 
-var tools Tools
-var loadShopwareVersions sync.RWMutex
-var shopwareVersions string
-
-func init() {
-	releaseNotes := orderedmap.New[string, *jsonschema.Schema]()
-	releaseNotes.Set("version", &jsonschema.Schema{
-		Type:        "string",
-		Description: "The Shopware version to get the release notes for",
-	})
+type GithubRelease struct {
+	TagName     string `json:"tag_name"`
+	PublishedAt string `json:"published_at"`
+}
 
-	storePlugin := orderedmap.New[string, *jsonschema.Schema]()
-	storePlugin.Set("name", &jsonschema.Schema{
-		Type:        "array",
-		Description: "The name of the extension/plugin/app in the Shopware Store",
-		Items: &jsonschema.Schema{
-			Type: "string",
-		},
-	})
+// shopwareVersionsTool lists the Shopware releases. The list is fetched once
+// and cached for the lifetime of the process.
+type shopwareVersionsTool struct {
+	mu       sync.RWMutex
+	versions string
+}
 
-	tools = []copilot.FunctionTool{
-		{
-			Type: "function",
-			Function: copilot.Function{
-				Name:        "get_shopware_versions",
-				Description: "Get all available Shopware versions",
-			},
-		},
-		{
-			Type: "function",
-			Function: copilot.Function{
-				Name:        "get_release_notes",
-				Description: "Get the release notes or changelog for a specific Shopware version",
-				Parameters: &jsonschema.Schema{
-					Type:       "object",
-					Properties: releaseNotes,
-					Required:   []string{"version"},
-				},
-			},
-		},
-		{
-			Type: "function",
-			Function: copilot.Function{
-				Name:        "get_store_extension",
-				Description: "Get name, description and changelog of multiple extension/plugin/app in the Shopware Store",
-				Parameters: &jsonschema.Schema{
-					Type:       "object",
-					Properties: storePlugin,
-					Required:   []string{"name"},
-				},
-			},
-		},
-	}
+func (t *shopwareVersionsTool) Name() string {
+	return "get_shopware_versions"
 }
 
-func handleFunction(ctx context.Context, function *copilot.ChatMessageFunctionCall) (*copilot.ChatMessage, error) {
-	switch function.Name {
-	case "get_shopware_versions":
-		return getShopwareVersions(ctx)
-	case "get_release_notes":
-		return getReleaseNotes(ctx, function.Arguments)
-	case "get_store_extension":
-		return getStoreExtension(ctx, function.Arguments)
-	default:
-		return nil, fmt.Errorf("unknown function: %s", function.Name)
-	}
+func (t *shopwareVersionsTool) Description() string {
+	return "Get all available Shopware versions"
 }
 
-type GithubRelease struct {
-	TagName     string `json:"tag_name"`
-	PublishedAt string `json:"published_at"`
+func (t *shopwareVersionsTool) Parameters() *jsonschema.Schema {
+	return nil
 }
 
-func getShopwareVersions(ctx context.Context) (*copilot.ChatMessage, error) {
-	loadShopwareVersions.RLock()
+func (t *shopwareVersionsTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	t.mu.RLock()
+	versions := t.versions
+	t.mu.RUnlock()
 
-	if shopwareVersions != "" {
-		loadShopwareVersions.RUnlock()
-		return &copilot.ChatMessage{
-			Role:    "system",
-			Content: shopwareVersions,
-		}, nil
+	if versions != "" {
+		return t.result(versions), nil
 	}
 
-	loadShopwareVersions.RUnlock()
-
-	loadShopwareVersions.Lock()
-	defer loadShopwareVersions.Unlock()
-
+	// The lock isn't held while fetching, a slow request must not block the
+	// other calls. Concurrent first calls may fetch the list twice.
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/repos/shopware/shopware/releases?per_page=100", nil)
 
 	resp, err := http.DefaultClient.Do(req)
@@ -128,6 +67,8 @@ func getShopwareVersions(ctx context.Context) (*copilot.ChatMessage, error) {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
@@ -139,16 +80,51 @@ func getShopwareVersions(ctx context.Context) (*copilot.ChatMessage, error) {
 	}
 
 	for _, release := range releases {
-		shopwareVersions += fmt.Sprintf("%s released at: %s\n", release.TagName, release.PublishedAt)
+		versions += fmt.Sprintf("%s released at: %s\n", release.TagName, release.PublishedAt)
 	}
 
-	return &copilot.ChatMessage{
-		Role:    "system",
-		Content: shopwareVersions,
-	}, nil
+	t.mu.Lock()
+	t.versions = versions
+	t.mu.Unlock()
+
+	return t.result(versions), nil
+}
+
+func (t *shopwareVersionsTool) result(versions string) *ToolResult {
+	return &ToolResult{
+		Content: versions,
+		References: []Reference{
+			{ID: "shopware-releases", DisplayName: "Shopware releases", URL: "https://github.com/shopware/shopware/releases"},
+		},
+	}
+}
+
+// releaseNotesTool fetches the release notes of a Shopware version.
+type releaseNotesTool struct{}
+
+func (releaseNotesTool) Name() string {
+	return "get_release_notes"
 }
 
-func getReleaseNotes(ctx context.Context, arguments string) (*copilot.ChatMessage, error) {
+func (releaseNotesTool) Description() string {
+	return "Get the release notes or changelog for a specific Shopware version"
+}
+
+func (releaseNotesTool) Parameters() *jsonschema.Schema {
+	properties := orderedmap.New[string, *jsonschema.Schema]()
+	properties.Set("version", &jsonschema.Schema{
+		Type:        "string",
+		Description: "The Shopware version to get the release notes for",
+	})
+
+	return &jsonschema.Schema{
+		Type:       "object",
+		Properties: properties,
+		Required:   []string{"version"},
+	}
+}
+
+func (releaseNotesTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
 	var parameters struct {
 		Version string `json:"version"`
 	}
@@ -159,6 +135,11 @@ func getReleaseNotes(ctx context.Context, arguments string) (*copilot.ChatMessag
 
 	normalizedVersion := strings.TrimPrefix(parameters.Version, "v")
 
+	// The release notes are grouped by the major version like 6.5
+	if len(normalizedVersion) < 3 {
+		return nil, fmt.Errorf("invalid version %q, expected a version like 6.5.8.0", parameters.Version)
+	}
+
 	shortVersion := normalizedVersion[0:3]
 
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://raw.githubusercontent.com/shopware/release-notes/refs/heads/main/src/%s/%s.md", shortVersion, normalizedVersion), nil)
@@ -169,31 +150,57 @@ func getReleaseNotes(ctx context.Context, arguments string) (*copilot.ChatMessag
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
-		return &copilot.ChatMessage{
-			Role:    "system",
-			Content: "",
-		}, nil
+		return &ToolResult{}, nil
 	}
 
-	defer resp.Body.Close()
-
 	content, err := io.ReadAll(resp.Body)
 
 	if err != nil {
-		return &copilot.ChatMessage{
-			Role:    "system",
-			Content: "",
-		}, nil
+		return &ToolResult{}, nil
 	}
 
-	return &copilot.ChatMessage{
-		Role:    "system",
+	link := fmt.Sprintf("https://github.com/shopware/release-notes/blob/main/src/%s/%s.md", shortVersion, normalizedVersion)
+
+	return &ToolResult{
 		Content: string(content),
+		References: []Reference{
+			{ID: link, DisplayName: fmt.Sprintf("Release notes %s", normalizedVersion), URL: link},
+		},
 	}, nil
 }
 
-func getStoreExtension(ctx context.Context, arguments string) (*copilot.ChatMessage, error) {
+// storeExtensionTool looks up extensions in the Shopware Store.
+type storeExtensionTool struct{}
+
+func (storeExtensionTool) Name() string {
+	return "get_store_extension"
+}
+
+func (storeExtensionTool) Description() string {
+	return "Get name, description and changelog of multiple extension/plugin/app in the Shopware Store"
+}
+
+func (storeExtensionTool) Parameters() *jsonschema.Schema {
+	properties := orderedmap.New[string, *jsonschema.Schema]()
+	properties.Set("name", &jsonschema.Schema{
+		Type:        "array",
+		Description: "The name of the extension/plugin/app in the Shopware Store",
+		Items: &jsonschema.Schema{
+			Type: "string",
+		},
+	})
+
+	return &jsonschema.Schema{
+		Type:       "object",
+		Properties: properties,
+		Required:   []string{"name"},
+	}
+}
+
+func (storeExtensionTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
 	var parameters struct {
 		Name []string `json:"name"`
 	}
@@ -222,6 +229,8 @@ func getStoreExtension(ctx context.Context, arguments string) (*copilot.ChatMess
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
@@ -258,8 +267,15 @@ func getStoreExtension(ctx context.Context, arguments string) (*copilot.ChatMess
 		}
 	}
 
-	return &copilot.ChatMessage{
-		Role:    "system",
-		Content: string(content),
+	references := make([]Reference, 0, len(parameters.Name))
+
+	for _, name := range parameters.Name {
+		link := fmt.Sprintf("https://store.shopware.com/en/search/?search=%s", url.QueryEscape(name))
+		references = append(references, Reference{ID: link, DisplayName: fmt.Sprintf("Shopware Store: %s", name), URL: link})
+	}
+
+	return &ToolResult{
+		Content:    string(content),
+		References: references,
 	}, nil
 }
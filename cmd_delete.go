@@ -10,7 +10,7 @@ var deleteCmd = &cobra.Command{
 	Short: "Delete document from vector db",
 	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := config.New()
+		cfg, err := config.Load(cmd.Flags())
 
 		if err != nil {
 			return err
@@ -22,10 +22,23 @@ var deleteCmd = &cobra.Command{
 			return err
 		}
 
-		return collection.Delete(cmd.Context(), nil, nil, args...)
+		if err := collection.Delete(cmd.Context(), nil, nil, args...); err != nil {
+			return err
+		}
+
+		lexical, err := config.GetLexicalIndex(cfg)
+
+		if err != nil {
+			return err
+		}
+
+		lexical.Remove(args...)
+
+		return lexical.Save()
 	},
 }
 
 func init() {
+	config.RegisterFlags(deleteCmd.Flags(), config.DatabaseSettings...)
 	rootCmd.AddCommand(deleteCmd)
 }
@@ -2,36 +2,34 @@ package main
 
 import (
 	"fmt"
-	"io/fs"
+	"maps"
 	"os"
-	"path/filepath"
-	"regexp"
-	"strings"
+	"strconv"
 	"sync"
 
 	"github.com/charmbracelet/log"
 	"github.com/philippgille/chromem-go"
 	"github.com/shopwarelabs/copilot-extension/config"
+	"github.com/shopwarelabs/copilot-extension/indexer"
 	"github.com/spf13/cobra"
-	"github.com/tmc/langchaingo/documentloaders"
-	"github.com/tmc/langchaingo/textsplitter"
 )
 
 var (
-	workers int
+	workers      int
+	manifestPath string
 )
 
 type indexJob struct {
-	fileName string
-	index    int
-	total    int
+	file  indexer.File
+	index int
+	total int
 }
 
 var indexCommand = &cobra.Command{
 	Use:   "index",
-	Short: "Embed all files in the data directory to the vector database",
+	Short: "Embed all files of the configured sources to the vector database",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := config.New()
+		cfg, err := config.Load(cmd.Flags())
 
 		if err != nil {
 			return err
@@ -43,93 +41,175 @@ var indexCommand = &cobra.Command{
 			return err
 		}
 
-		fileNames := make([]string, 0)
-		err = filepath.WalkDir("data", func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				return err
-			}
+		lexical, err := config.GetLexicalIndex(cfg)
 
-			if d.IsDir() {
-				return nil
-			}
+		if err != nil {
+			return err
+		}
 
-			if strings.Contains(path, "draco") {
-				return nil
-			}
+		if manifestPath == "" {
+			manifestPath = config.ManifestPath(cfg)
+		}
 
-			if strings.HasSuffix(d.Name(), ".md") || strings.HasSuffix(d.Name(), ".js") || strings.HasSuffix(d.Name(), ".php") || strings.HasSuffix(d.Name(), ".scss") || strings.HasSuffix(d.Name(), ".css") || strings.HasSuffix(d.Name(), ".twig") {
-				fileNames = append(fileNames, path)
-			}
+		manifest, err := indexer.LoadManifest(manifestPath)
 
-			return nil
-		})
+		if err != nil {
+			return err
+		}
+
+		sources, err := config.LoadSources(cfg.SourcesFile)
 
 		if err != nil {
-			return fmt.Errorf("failed to walk directory: %w", err)
+			return err
 		}
 
-		if len(fileNames) == 0 {
-			return fmt.Errorf("no files found to index")
+		files, err := indexer.FindFiles(sources)
+
+		if err != nil {
+			return err
 		}
 
-		split := textsplitter.NewRecursiveCharacter()
-		split.ChunkSize = 12000
-		split.ChunkOverlap = 30
+		if len(files) == 0 {
+			return fmt.Errorf("no files found to index")
+		}
 
-		filesCount := len(fileNames)
+		filesCount := len(files)
 		jobs := make(chan indexJob)
 		errChan := make(chan error)
 		var wg sync.WaitGroup
 
-		re := regexp.MustCompile(`(?s)^---\n.*?---\n`)
-
 		// Start worker pool
 		for w := 1; w <= workers; w++ {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
 				for job := range jobs {
-					content, err := os.Open(job.fileName)
+					fileName := job.file.Path
+					fingerprint := job.file.Source.Fingerprint()
+
+					content, err := os.ReadFile(fileName)
 					if err != nil {
-						errChan <- fmt.Errorf("failed to open file %s: %w", job.fileName, err)
+						errChan <- fmt.Errorf("failed to open file %s: %w", fileName, err)
 						continue
 					}
 
-					p := documentloaders.NewText(content)
-					docs, err := p.LoadAndSplit(cmd.Context(), split)
-					content.Close()
+					hash := indexer.HashContent(content)
+					previous, known := manifest.Get(fileName)
+
+					if known && previous.Hash == hash && previous.Source == fingerprint && previous.Splitter == indexer.SplitterVersion {
+						log.Debugf("Skipping unchanged [%d/%d] %s", job.index+1, job.total, fileName)
+
+						// Fill the lexical index with chunks embedded before it existed
+						for _, documentId := range previous.Chunks {
+							if lexical.Has(documentId) {
+								continue
+							}
+
+							if doc, err := collection.GetByID(cmd.Context(), documentId); err == nil {
+								lexical.Add(doc.ID, doc.Content, doc.Metadata)
+							}
+						}
+
+						continue
+					}
+
+					splitter := indexer.SplitterFor(job.file.RelPath, job.file.Source.Chunking)
+					chunks, err := splitter.Split(string(content))
 
 					if err != nil {
-						errChan <- fmt.Errorf("failed to split file %s: %w", job.fileName, err)
+						errChan <- fmt.Errorf("failed to split file %s: %w", fileName, err)
 						continue
 					}
 
-					log.Infof("Indexing [%d/%d] %s", job.index+1, job.total, job.fileName)
+					log.Infof("Indexing [%d/%d] %s", job.index+1, job.total, fileName)
 
-					for idx, doc := range docs {
-						documentId := fmt.Sprintf("%s_%d", job.fileName, idx)
+					chunkIDs := make([]string, 0, len(chunks))
+					failed := false
+
+					for idx, chunk := range chunks {
+						documentId := fmt.Sprintf("%s_%d", fileName, idx)
+						chunkIDs = append(chunkIDs, documentId)
 
 						lookupDoc, err := collection.GetByID(cmd.Context(), documentId)
 
-						pathSplit := strings.Split(job.fileName, "/")
-						source := pathSplit[1]
+						text := chunk.Text()
 
-						doc.PageContent = re.ReplaceAllString(doc.PageContent, "")
+						metadata := map[string]string{
+							"source": job.file.Source.Name,
+							"file":   fileName,
+							"repo":   job.file.Source.Repository,
+							"ref":    job.file.Source.Ref,
+							"path":   job.file.Source.UpstreamPath(job.file.RelPath),
+							"url":    job.file.Source.URL(job.file.RelPath, chunk.StartLine, chunk.EndLine),
+						}
+
+						if chunk.StartLine > 0 {
+							metadata["start_line"] = strconv.Itoa(chunk.StartLine)
+							metadata["end_line"] = strconv.Itoa(chunk.EndLine)
+						}
+
+						maps.Copy(metadata, chunk.Metadata)
+
+						if err != nil || lookupDoc.Content != text || !maps.Equal(lookupDoc.Metadata, metadata) {
+							var embedding []float32
+
+							// Only the metadata changed, the embedding can be reused
+							if err == nil && lookupDoc.Content == text {
+								embedding = lookupDoc.Embedding
+							}
 
-						if err != nil || lookupDoc.Content != doc.PageContent {
 							if err := collection.AddDocument(cmd.Context(), chromem.Document{
-								ID:      fmt.Sprintf("%s_%d", job.fileName, idx),
-								Content: doc.PageContent,
-								Metadata: map[string]string{
-									"source": source,
-									"file":   job.fileName,
-								},
+								ID:        documentId,
+								Content:   text,
+								Metadata:  metadata,
+								Embedding: embedding,
 							}); err != nil {
 								log.Error("failed to index document", "error", err)
+								failed = true
 								continue
 							}
 						}
+
+						lexical.Add(documentId, text, metadata)
 					}
+
+					var stale []string
+					if known {
+						stale = indexer.StaleChunks(previous.Chunks, chunkIDs)
+					} else {
+						// Without a manifest entry we don't know how many chunks an
+						// earlier run created, so probe the IDs following the last chunk.
+						for idx := len(chunks); ; idx++ {
+							documentId := fmt.Sprintf("%s_%d", fileName, idx)
+							if _, err := collection.GetByID(cmd.Context(), documentId); err != nil {
+								break
+							}
+							stale = append(stale, documentId)
+						}
+					}
+
+					if len(stale) > 0 {
+						if err := collection.Delete(cmd.Context(), nil, nil, stale...); err != nil {
+							errChan <- fmt.Errorf("failed to delete stale chunks of %s: %w", fileName, err)
+							continue
+						}
+
+						lexical.Remove(stale...)
+
+						log.Infof("Removed %d stale chunks of %s", len(stale), fileName)
+					}
+
+					// Leave failed files out of the manifest so the next run retries them
+					if failed {
+						continue
+					}
+
+					manifest.Set(fileName, indexer.ManifestEntry{
+						Hash:     hash,
+						Source:   fingerprint,
+						Splitter: indexer.SplitterVersion,
+						Chunks:   chunkIDs,
+					})
 				}
 			}()
 		}
@@ -142,11 +222,11 @@ var indexCommand = &cobra.Command{
 
 		// Send jobs to workers
 		go func() {
-			for i, fileName := range fileNames {
+			for i, file := range files {
 				jobs <- indexJob{
-					fileName: fileName,
-					index:    i,
-					total:    filesCount,
+					file:  file,
+					index: i,
+					total: filesCount,
 				}
 			}
 			close(jobs)
@@ -157,11 +237,42 @@ var indexCommand = &cobra.Command{
 			log.Error("worker error", "error", err)
 		}
 
-		return nil
+		// Prune chunks of files which no longer exist
+		existing := make(map[string]struct{}, len(files))
+		for _, file := range files {
+			existing[file.Path] = struct{}{}
+		}
+
+		for _, fileName := range manifest.Files() {
+			if _, ok := existing[fileName]; ok {
+				continue
+			}
+
+			entry, _ := manifest.Get(fileName)
+
+			if len(entry.Chunks) > 0 {
+				if err := collection.Delete(cmd.Context(), nil, nil, entry.Chunks...); err != nil {
+					log.Error("failed to delete chunks of removed file", "file", fileName, "error", err)
+					continue
+				}
+			}
+
+			lexical.Remove(entry.Chunks...)
+			manifest.Remove(fileName)
+			log.Infof("Removed %d chunks of deleted file %s", len(entry.Chunks), fileName)
+		}
+
+		if err := lexical.Save(); err != nil {
+			return err
+		}
+
+		return manifest.Save()
 	},
 }
 
 func init() {
 	indexCommand.Flags().IntVarP(&workers, "workers", "w", 4, "Number of parallel workers")
+	indexCommand.Flags().StringVar(&manifestPath, "manifest", "", "Path of the index manifest used for incremental indexing, defaults to manifest.json in the database directory")
+	config.RegisterFlags(indexCommand.Flags(), append(config.DatabaseSettings, "sources_file")...)
 	rootCmd.AddCommand(indexCommand)
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/shopwarelabs/copilot-extension/copilot"
+	"github.com/spf13/cobra"
+)
+
+var (
+	modelsToken         string
+	modelsIntegrationID string
+)
+
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "List the chat models the Copilot API offers for a token",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if modelsToken == "" {
+			modelsToken = os.Getenv("GITHUB_TOKEN")
+		}
+
+		if modelsToken == "" {
+			return fmt.Errorf("a GitHub token is required, pass --token or set GITHUB_TOKEN")
+		}
+
+		models, err := copilot.ListModels(cmd.Context(), copilot.NewClient(), modelsIntegrationID, modelsToken)
+
+		if err != nil {
+			return fmt.Errorf("failed to list models: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tVENDOR\tTYPE\tCONTEXT\tOUTPUT\tTOOLS")
+
+		for _, model := range models {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%t\n",
+				model.ID,
+				model.Vendor,
+				model.Capabilities.Type,
+				model.Capabilities.Limits.MaxContextWindowTokens,
+				model.Capabilities.Limits.MaxOutputTokens,
+				model.Capabilities.Supports.ToolCalls,
+			)
+		}
+
+		return w.Flush()
+	},
+}
+
+func init() {
+	modelsCmd.Flags().StringVar(&modelsToken, "token", "", "GitHub token with Copilot access, defaults to GITHUB_TOKEN")
+	modelsCmd.Flags().StringVar(&modelsIntegrationID, "integration-id", "", "Copilot integration ID sent with the request")
+	rootCmd.AddCommand(modelsCmd)
+}
@@ -12,26 +12,26 @@ var cmdSearch = &cobra.Command{
 	Short: "Search for documents",
 	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := config.New()
+		cfg, err := config.Load(cmd.Flags())
 
 		if err != nil {
 			return err
 		}
 
-		collection, err := config.GetCollection(cfg)
+		retriever, err := config.GetRetriever(cfg)
 
 		if err != nil {
 			return err
 		}
 
-		result, err := collection.Query(cmd.Context(), args[0], 20, nil, nil)
+		result, err := retriever.Query(cmd.Context(), args[0], 20, nil)
 
 		if err != nil {
 			return err
 		}
 
 		for _, r := range result {
-			fmt.Printf("%f - %s\n", r.Similarity, r.ID)
+			fmt.Printf("%f (%f) - %s\n", r.Score, r.Similarity, r.ID)
 		}
 
 		return nil
@@ -39,5 +39,6 @@ var cmdSearch = &cobra.Command{
 }
 
 func init() {
+	config.RegisterFlags(cmdSearch.Flags(), config.DatabaseSettings...)
 	rootCmd.AddCommand(cmdSearch)
 }
@@ -1,58 +1,213 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/charmbracelet/log"
 	"github.com/shopwarelabs/copilot-extension/agent"
 	"github.com/shopwarelabs/copilot-extension/config"
+	"github.com/shopwarelabs/copilot-extension/copilot"
 	"github.com/shopwarelabs/copilot-extension/oauth"
 	"github.com/spf13/cobra"
 )
 
+const (
+	// readHeaderTimeout only covers the headers, the body of a request and
+	// the streamed answer can take much longer
+	readHeaderTimeout = 10 * time.Second
+	idleTimeout       = 2 * time.Minute
+)
+
 var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Starts the server",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		pubKey, err := fetchPublicKey()
+		cfg, err := config.Load(cmd.Flags())
 		if err != nil {
-			return fmt.Errorf("failed to fetch public key: %w", err)
+			return fmt.Errorf("error fetching config: %w", err)
 		}
 
-		cfg, err := config.New()
+		if err := cfg.ValidateServer(); err != nil {
+			return err
+		}
+
+		// The keys are loaded in the background, so the server starts without
+		// access to GitHub
+		verifier, err := config.GetVerifier(cfg)
+
 		if err != nil {
-			return fmt.Errorf("error fetching config: %w", err)
+			return fmt.Errorf("failed to set up signature verification: %w", err)
 		}
 
-		me, err := url.Parse(cfg.FQDN)
+		go func() {
+			if err := verifier.Refresh(cmd.Context()); err != nil {
+				log.Warn("failed to load public keys, requests will retry loading them", "error", err)
+			}
+		}()
+
+		retriever, err := config.GetRetriever(cfg)
+
 		if err != nil {
-			return fmt.Errorf("unable to parse HOST environment variable: %w", err)
+			return fmt.Errorf("failed to get retriever: %w", err)
+		}
+
+		mux := http.NewServeMux()
+
+		// The GitHub app is optional in development mode
+		if cfg.ClientID != "" {
+			me, err := url.Parse(cfg.FQDN)
+			if err != nil {
+				return fmt.Errorf("unable to parse fqdn: %w", err)
+			}
+
+			me.Path = "auth/callback"
+
+			oauthService := oauth.NewService(cfg.ClientID, cfg.ClientSecret, me.String())
+			mux.HandleFunc("/auth/authorization", oauthService.PreAuth)
+			mux.HandleFunc("/auth/callback", oauthService.PostAuth)
 		}
 
-		collection, err := config.GetCollection(cfg)
+		// The source names let the model restrict its searches, the server
+		// works without them
+		var sourceNames []string
+		if sources, err := config.LoadSources(cfg.SourcesFile); err == nil {
+			for _, source := range sources {
+				sourceNames = append(sourceNames, source.Name)
+			}
+		} else {
+			log.Warn("failed to load sources, search_docs can't filter by source", "error", err)
+		}
+
+		tools, err := agent.NewRegistry(append(agent.DefaultTools(), agent.NewSearchDocsTool(retriever, sourceNames))...)
 
 		if err != nil {
-			return fmt.Errorf("failed to get collection: %w", err)
+			return err
 		}
 
-		me.Path = "auth/callback"
+		tools, err = tools.Filter(cfg.EnabledTools, cfg.DisabledTools)
 
-		oauthService := oauth.NewService(cfg.ClientID, cfg.ClientSecret, me.String())
-		http.HandleFunc("/auth/authorization", oauthService.PreAuth)
-		http.HandleFunc("/auth/callback", oauthService.PostAuth)
+		if err != nil {
+			return fmt.Errorf("failed to configure tools: %w", err)
+		}
 
-		agentService := agent.NewService(pubKey, collection, os.Getenv("DEBUG") == "true")
+		provider, err := config.GetProvider(cfg)
 
-		http.HandleFunc("/agent", agentService.ChatCompletion)
-		http.HandleFunc("/search", agent.NewSearchService(collection).Search)
+		if err != nil {
+			return err
+		}
+
+		allowedModels := make([]copilot.Model, 0, len(cfg.AllowedModels))
+		for _, model := range cfg.AllowedModels {
+			allowedModels = append(allowedModels, copilot.Model(model))
+		}
 
-		fmt.Println("Listening on port 8000")
-		return http.ListenAndServe(":8000", nil)
+		agentService := agent.NewService(verifier, retriever, provider, tools, agent.Options{
+			Model:            copilot.Model(cfg.ChatModel),
+			RetrievalLimit:   cfg.RetrievalLimit,
+			AllowedModels:    allowedModels,
+			QueryTurns:       cfg.QueryTurns,
+			QueryRewrite:     cfg.QueryRewrite,
+			ContextTokens:    cfg.ContextTokens,
+			ResponseTokens:   cfg.ResponseTokens,
+			ToolTokens:       cfg.ToolTokens,
+			ToolTimeout:      cfg.ToolTimeout,
+			MaxToolRounds:    cfg.MaxToolRounds,
+			UpfrontRetrieval: cfg.UpfrontRetrieval,
+		})
+
+		mux.HandleFunc("/agent", agentService.ChatCompletion)
+		mux.HandleFunc("/search", agent.NewSearchService(retriever).Search)
+
+		healthService := agent.NewHealthService(retriever, verifier, cfg.OllamaHost)
+		mux.HandleFunc("/healthz", healthService.Healthz)
+		mux.HandleFunc("/readyz", healthService.Readyz)
+
+		servers := []*http.Server{{
+			Addr:              cfg.ListenAddress,
+			Handler:           mux,
+			ReadHeaderTimeout: readHeaderTimeout,
+			IdleTimeout:       idleTimeout,
+		}}
+
+		// The counters are served apart from the public endpoints, so they
+		// can be limited to the cluster or the host
+		if cfg.MetricsAddress != "" {
+			metricsMux := http.NewServeMux()
+			metricsMux.HandleFunc("/debug/vars", agent.Metrics)
+
+			servers = append(servers, &http.Server{
+				Addr:              cfg.MetricsAddress,
+				Handler:           metricsMux,
+				ReadHeaderTimeout: readHeaderTimeout,
+				IdleTimeout:       idleTimeout,
+			})
+		}
+
+		return serve(cmd.Context(), cfg.ShutdownTimeout, servers...)
 	},
 }
 
+// serve runs the servers until they receive SIGINT or SIGTERM or one of them
+// fails. They then stop accepting connections and wait up to timeout for
+// active streams to finish before closing them.
+func serve(ctx context.Context, timeout time.Duration, servers ...*http.Server) error {
+	signalCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func() {
+			fmt.Printf("Listening on %s\n", server.Addr)
+			errs <- server.ListenAndServe()
+		}()
+	}
+
+	var err error
+	running := len(servers)
+
+	select {
+	case err = <-errs:
+		running--
+	case <-signalCtx.Done():
+	}
+
+	// A second signal terminates immediately
+	stop()
+
+	log.Info("shutting down, waiting for active requests", "timeout", timeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	for _, server := range servers {
+		if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+			log.Warn("active requests did not finish in time, closing them", "address", server.Addr, "error", shutdownErr)
+			server.Close()
+		}
+	}
+
+	for ; running > 0; running-- {
+		if serveErr := <-errs; err == nil {
+			err = serveErr
+		}
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
 func init() {
+	config.RegisterFlags(serverCmd.Flags())
 	rootCmd.AddCommand(serverCmd)
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/shopwarelabs/copilot-extension/config"
+	"github.com/shopwarelabs/copilot-extension/signature"
+	"github.com/spf13/cobra"
+)
+
+var signCmd = &cobra.Command{
+	Use:   "sign [payload file]",
+	Short: "Sign a request payload with the development key and print the signature headers",
+	Long: "Sign a request payload with the development key and print the signature headers. " +
+		"The payload is read from stdin without a file. A server started with DEV_MODE=true accepts requests with these headers.",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var payload []byte
+		var err error
+
+		if len(args) == 1 {
+			payload, err = os.ReadFile(args[0])
+		} else {
+			payload, err = io.ReadAll(cmd.InOrStdin())
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read payload: %w", err)
+		}
+
+		cfg, err := config.Load(cmd.Flags())
+
+		if err != nil {
+			return err
+		}
+
+		key, err := signature.LoadOrCreateDevKey(cfg.DevKeyFile)
+
+		if err != nil {
+			return err
+		}
+
+		sig, err := signature.Sign(payload, key)
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Github-Public-Key-Identifier: %s\n", signature.DevKeyID)
+		fmt.Fprintf(cmd.OutOrStdout(), "Github-Public-Key-Signature: %s\n", sig)
+
+		return nil
+	},
+}
+
+func init() {
+	config.RegisterFlags(signCmd.Flags(), "dev_key_file")
+	rootCmd.AddCommand(signCmd)
+}
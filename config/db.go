@@ -1,20 +1,50 @@
 package config
 
 import (
+	"path/filepath"
+
 	"github.com/philippgille/chromem-go"
+	"github.com/shopwarelabs/copilot-extension/retrieval"
 )
 
 func GetCollection(cfg *Info) (*chromem.Collection, error) {
-	db, err := chromem.NewPersistentDB("./db", true)
+	db, err := chromem.NewPersistentDB(cfg.DBPath, true)
 
 	if err != nil {
 		return nil, err
 	}
 
-	collection, err := db.GetOrCreateCollection("shopware_1", nil, chromem.NewEmbeddingFuncOllama("mxbai-embed-large", cfg.OllamaHost))
+	collection, err := db.GetOrCreateCollection(cfg.Collection, nil, chromem.NewEmbeddingFuncOllama(cfg.EmbeddingModel, cfg.OllamaHost))
 	if err != nil {
 		return nil, err
 	}
 
 	return collection, nil
 }
+
+// GetLexicalIndex loads the lexical index which is stored next to the
+// collection.
+func GetLexicalIndex(cfg *Info) (*retrieval.LexicalIndex, error) {
+	return retrieval.LoadLexicalIndex(filepath.Join(cfg.DBPath, "lexical.gob"))
+}
+
+// ManifestPath is where the index command keeps its manifest by default.
+func ManifestPath(cfg *Info) string {
+	return filepath.Join(cfg.DBPath, "manifest.json")
+}
+
+// GetRetriever returns a retriever combining the collection with the lexical
+// index.
+func GetRetriever(cfg *Info) (*retrieval.Retriever, error) {
+	collection, err := GetCollection(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	lexical, err := GetLexicalIndex(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return retrieval.New(collection, lexical), nil
+}
@@ -1,8 +1,17 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
 )
 
 type Info struct {
@@ -16,42 +25,389 @@ type Info struct {
 	// ClientSecret comes from your configured GitHub app
 	ClientSecret string
 
+	// ListenAddress is the address the server listens on
+	ListenAddress string
+
+	// MetricsAddress is the internal address the counters are served on at
+	// /debug/vars, they are not served when empty
+	MetricsAddress string
+
+	// ShutdownTimeout limits how long the server waits for active requests
+	// when it is stopped
+	ShutdownTimeout time.Duration
+
 	// OllamaHost is the host address of the Ollama API
 	OllamaHost string
+
+	// DBPath is the directory of the vector database, the lexical index and
+	// the manifest
+	DBPath string
+
+	// Collection is the name of the collection in the vector database
+	Collection string
+
+	// EmbeddingModel is the Ollama model the documents are embedded with
+	EmbeddingModel string
+
+	// SourcesFile is the source registry of the index and server commands
+	SourcesFile string
+
+	// PublicKeysFile contains the keys request signatures are checked with, in
+	// the format of the GitHub API. The keys are fetched from GitHub when empty.
+	PublicKeysFile string
+
+	// DevMode checks request signatures with a local key instead of the keys
+	// of GitHub, requests are signed with the sign command
+	DevMode bool
+
+	// DevKeyFile is the private key of the development mode, it is created
+	// when missing
+	DevKeyFile string
+
+	// ChatProvider is the chat backend: copilot, openai or ollama
+	ChatProvider string
+
+	// ChatBaseURL is the API address of the openai and ollama providers
+	ChatBaseURL string
+
+	// ChatAPIKey authenticates against the openai provider
+	ChatAPIKey string
+
+	// EnabledTools limits the tools offered to the model, all when empty
+	EnabledTools []string
+
+	// DisabledTools are never offered to the model
+	DisabledTools []string
+
+	// ChatModel answers the questions unless the request picks one of the
+	// AllowedModels
+	ChatModel string
+
+	// AllowedModels may be requested by the client, empty to always use
+	// ChatModel
+	AllowedModels []string
+
+	// RetrievalLimit is how many documents are added to the prompt up front
+	RetrievalLimit int
+
+	// QueryTurns is how many recent user messages form the retrieval query
+	QueryTurns int
+
+	// QueryRewrite asks the model for a standalone retrieval query
+	QueryRewrite bool
+
+	// ContextTokens is the size of the context window of ChatModel
+	ContextTokens int
+
+	// ResponseTokens is the part of the context window kept for the answer
+	ResponseTokens int
+
+	// ToolTokens is the part of the context window kept for tool results
+	ToolTokens int
+
+	// ToolTimeout is how long a single tool call may run
+	ToolTimeout time.Duration
+
+	// UpfrontRetrieval retrieves documents before asking the model, when off
+	// the model uses the search_docs tool
+	UpfrontRetrieval bool
+
+	// MaxToolRounds is how many rounds of tool calls an answer may take
+	MaxToolRounds int
 }
 
-const (
-	clientIdEnv     = "CLIENT_ID"
-	clientSecretEnv = "CLIENT_SECRET"
-	fqdnEnv         = "FQDN"
-	ollamaHost      = "OLLAMA_HOST"
-)
+// DefaultFile is the config file read when no other file is given.
+const DefaultFile = "config.yaml"
+
+// DefaultDevKeyFile is where the private key of the development mode is
+// stored by default.
+const DefaultDevKeyFile = ".dev/signing-key.pem"
 
-func New() (*Info, error) {
-	fqdn := os.Getenv(fqdnEnv)
-	if fqdn == "" {
-		return nil, fmt.Errorf("%s environment variable required", fqdnEnv)
+// configFileEnv names the config file, the --config flag takes precedence.
+const configFileEnv = "CONFIG_FILE"
+
+// DatabaseSettings are the settings of the commands working with the
+// database.
+var DatabaseSettings = []string{"db_path", "collection", "embedding_model", "ollama_host"}
+
+func defaults() *Info {
+	return &Info{
+		ListenAddress:    ":8000",
+		ShutdownTimeout:  30 * time.Second,
+		OllamaHost:       "http://localhost:11434/api",
+		DBPath:           "./db",
+		Collection:       "shopware_1",
+		EmbeddingModel:   "mxbai-embed-large",
+		SourcesFile:      "sources.yaml",
+		DevKeyFile:       DefaultDevKeyFile,
+		ChatProvider:     "copilot",
+		ChatModel:        "gpt-4",
+		RetrievalLimit:   5,
+		QueryTurns:       3,
+		ContextTokens:    32768,
+		ResponseTokens:   4096,
+		ToolTokens:       8192,
+		ToolTimeout:      30 * time.Second,
+		UpfrontRetrieval: true,
+		MaxToolRounds:    5,
 	}
+}
+
+// setting is a configuration value. It is set in the config file by its key,
+// in the environment by env and on the command line by the key with dashes.
+type setting struct {
+	key   string
+	env   string
+	usage string
 
-	clientID := os.Getenv(clientIdEnv)
-	if clientID == "" {
-		return nil, fmt.Errorf("%s environment variable required", clientIdEnv)
+	// value points to the field of Info: *string, *int (positive), *bool,
+	// *time.Duration (positive) or *[]string (comma separated)
+	value any
+}
+
+func (i *Info) settings() []setting {
+	return []setting{
+		{"fqdn", "FQDN", "Internet facing address of the server, e.g. https://example.com", &i.FQDN},
+		{"client_id", "CLIENT_ID", "Client ID of the GitHub app", &i.ClientID},
+		{"client_secret", "CLIENT_SECRET", "Client secret of the GitHub app", &i.ClientSecret},
+		{"listen_address", "LISTEN_ADDRESS", "Address the server listens on", &i.ListenAddress},
+		{"metrics_address", "METRICS_ADDRESS", "Internal address the counters are served on, disabled when empty", &i.MetricsAddress},
+		{"shutdown_timeout", "SHUTDOWN_TIMEOUT", "Maximum time to wait for active requests on shutdown", &i.ShutdownTimeout},
+		{"ollama_host", "OLLAMA_HOST", "Address of the Ollama API", &i.OllamaHost},
+		{"db_path", "DB_PATH", "Directory of the vector database and the indexes", &i.DBPath},
+		{"collection", "COLLECTION", "Name of the collection in the vector database", &i.Collection},
+		{"embedding_model", "EMBEDDING_MODEL", "Ollama model the documents are embedded with", &i.EmbeddingModel},
+		{"sources_file", "SOURCES_FILE", "Path of the source registry", &i.SourcesFile},
+		{"public_keys_file", "PUBLIC_KEYS_FILE", "File with the keys request signatures are checked with, fetched from GitHub when empty", &i.PublicKeysFile},
+		{"dev_mode", "DEV_MODE", "Only accept requests signed with the local development key", &i.DevMode},
+		{"dev_key_file", "DEV_KEY_FILE", "Private key of the development mode, created when missing", &i.DevKeyFile},
+		{"chat_provider", "CHAT_PROVIDER", "Chat backend: copilot, openai or ollama", &i.ChatProvider},
+		{"chat_base_url", "CHAT_BASE_URL", "API address of the openai and ollama providers", &i.ChatBaseURL},
+		{"chat_api_key", "CHAT_API_KEY", "API key of the openai provider", &i.ChatAPIKey},
+		{"chat_model", "CHAT_MODEL", "Model answering the questions", &i.ChatModel},
+		{"allowed_models", "ALLOWED_MODELS", "Models a request may choose instead of the chat model", &i.AllowedModels},
+		{"retrieval_limit", "RETRIEVAL_LIMIT", "Number of documents retrieved up front", &i.RetrievalLimit},
+		{"query_turns", "QUERY_TURNS", "Number of recent user messages the retrieval query is built from", &i.QueryTurns},
+		{"query_rewrite", "QUERY_REWRITE", "Let the model rewrite follow-up questions into a standalone retrieval query", &i.QueryRewrite},
+		{"context_tokens", "CONTEXT_TOKENS", "Context window of the chat model", &i.ContextTokens},
+		{"response_tokens", "RESPONSE_TOKENS", "Tokens reserved for the answer", &i.ResponseTokens},
+		{"tool_tokens", "TOOL_TOKENS", "Tokens reserved for tool results", &i.ToolTokens},
+		{"tool_timeout", "TOOL_TIMEOUT", "Maximum runtime of a single tool call", &i.ToolTimeout},
+		{"tools_enabled", "TOOLS_ENABLED", "Tools offered to the model, all when empty", &i.EnabledTools},
+		{"tools_disabled", "TOOLS_DISABLED", "Tools which are never offered to the model", &i.DisabledTools},
+		{"upfront_retrieval", "UPFRONT_RETRIEVAL", "Add the documents matching the conversation to the prompt", &i.UpfrontRetrieval},
+		{"max_tool_rounds", "MAX_TOOL_ROUNDS", "Number of tool call rounds per answer", &i.MaxToolRounds},
 	}
+}
+
+// RegisterFlags adds the --config flag and the flags of the settings with the
+// given keys to flags, the flags of all settings without keys.
+func RegisterFlags(flags *pflag.FlagSet, keys ...string) {
+	flags.String("config", "", fmt.Sprintf("Config file, defaults to %s or %s when it exists", configFileEnv, DefaultFile))
+
+	for _, s := range defaults().settings() {
+		if len(keys) > 0 && !slices.Contains(keys, s.key) {
+			continue
+		}
+
+		name := flagName(s.key)
+		usage := fmt.Sprintf("%s (%s)", s.usage, s.env)
 
-	clientSecret := os.Getenv(clientSecretEnv)
-	if clientSecret == "" {
-		return nil, fmt.Errorf("%s environment variable required", clientSecretEnv)
+		switch value := s.value.(type) {
+		case *string:
+			flags.String(name, *value, usage)
+		case *int:
+			flags.Int(name, *value, usage)
+		case *bool:
+			flags.Bool(name, *value, usage)
+		case *time.Duration:
+			flags.Duration(name, *value, usage)
+		case *[]string:
+			flags.String(name, strings.Join(*value, ","), "Comma separated: "+usage)
+		}
 	}
+}
+
+// Load reads the configuration from the config file, the environment and the
+// flags set on the command line, each overriding the previous one.
+func Load(flags *pflag.FlagSet) (*Info, error) {
+	info := defaults()
+	settings := info.settings()
 
-	ollamaHost := os.Getenv(ollamaHost)
-	if ollamaHost == "" {
-		ollamaHost = "http://localhost:11434/api"
+	if err := loadFile(flags, settings); err != nil {
+		return nil, err
 	}
 
-	return &Info{
-		FQDN:         fqdn,
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		OllamaHost:   ollamaHost,
-	}, nil
+	for _, s := range settings {
+		value := os.Getenv(s.env)
+		if value == "" {
+			continue
+		}
+
+		if err := s.set(value); err != nil {
+			return nil, fmt.Errorf("invalid %s environment variable: %w", s.env, err)
+		}
+	}
+
+	if flags != nil {
+		for _, s := range settings {
+			flag := flags.Lookup(flagName(s.key))
+			if flag == nil || !flag.Changed {
+				continue
+			}
+
+			if err := s.set(flag.Value.String()); err != nil {
+				return nil, fmt.Errorf("invalid --%s flag: %w", flag.Name, err)
+			}
+		}
+	}
+
+	switch info.ChatProvider {
+	case "copilot":
+	case "openai":
+		if info.ChatBaseURL == "" {
+			info.ChatBaseURL = "https://api.openai.com/v1"
+		}
+	case "ollama":
+		if info.ChatBaseURL == "" {
+			info.ChatBaseURL = info.OllamaHost
+		}
+	default:
+		return nil, fmt.Errorf("chat_provider must be one of copilot, openai or ollama")
+	}
+
+	return info, nil
+}
+
+// ValidateServer checks the settings only the server needs. The GitHub app is
+// optional in development mode.
+func (i *Info) ValidateServer() error {
+	if i.DevMode {
+		return nil
+	}
+
+	switch {
+	case i.FQDN == "":
+		return requiredError("fqdn", "FQDN")
+	case i.ClientID == "":
+		return requiredError("client_id", "CLIENT_ID")
+	case i.ClientSecret == "":
+		return requiredError("client_secret", "CLIENT_SECRET")
+	}
+
+	return nil
+}
+
+func requiredError(key, env string) error {
+	return fmt.Errorf("%s is required, set it in the config file, the %s environment variable or with --%s", key, env, flagName(key))
+}
+
+// loadFile applies the config file given with the --config flag or the
+// environment, or the default file if it exists.
+func loadFile(flags *pflag.FlagSet, settings []setting) error {
+	file := os.Getenv(configFileEnv)
+	if flags != nil {
+		if flag := flags.Lookup("config"); flag != nil && flag.Changed {
+			file = flag.Value.String()
+		}
+	}
+
+	required := file != ""
+	if !required {
+		file = DefaultFile
+	}
+
+	content, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var values map[string]any
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", file, err)
+	}
+
+	for key, value := range values {
+		index := slices.IndexFunc(settings, func(s setting) bool {
+			return s.key == key
+		})
+
+		if index == -1 {
+			return fmt.Errorf("unknown setting %s in config file %s", key, file)
+		}
+
+		if err := settings[index].set(fileValue(value)); err != nil {
+			return fmt.Errorf("invalid %s in config file %s: %w", key, file, err)
+		}
+	}
+
+	return nil
+}
+
+// set parses value into the field of the setting.
+func (s setting) set(value string) error {
+	switch target := s.value.(type) {
+	case *string:
+		*target = value
+	case *int:
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			return fmt.Errorf("%q must be a positive number", value)
+		}
+		*target = number
+	case *bool:
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q must be true or false", value)
+		}
+		*target = enabled
+	case *time.Duration:
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("%q must be a positive duration like 30s", value)
+		}
+		*target = duration
+	case *[]string:
+		*target = splitList(value)
+	}
+
+	return nil
+}
+
+// fileValue converts a value of the config file to the format of the
+// environment variables, lists become comma separated.
+func fileValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case []any:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			items = append(items, fmt.Sprint(item))
+		}
+
+		return strings.Join(items, ",")
+	}
+
+	return fmt.Sprint(value)
+}
+
+// splitList splits a comma separated list, ignoring empty items.
+func splitList(value string) []string {
+	var list []string
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+func flagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
 }
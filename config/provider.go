@@ -0,0 +1,23 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/shopwarelabs/copilot-extension/copilot"
+)
+
+// GetProvider returns the configured chat backend.
+func GetProvider(cfg *Info) (copilot.Provider, error) {
+	client := copilot.NewClient()
+
+	switch cfg.ChatProvider {
+	case "", "copilot":
+		return copilot.NewCopilotProvider(client), nil
+	case "openai":
+		return copilot.NewOpenAIProvider(client, cfg.ChatBaseURL, cfg.ChatAPIKey), nil
+	case "ollama":
+		return copilot.NewOllamaProvider(client, cfg.ChatBaseURL), nil
+	}
+
+	return nil, fmt.Errorf("unknown chat provider: %s", cfg.ChatProvider)
+}
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultChunkSize    = 12000
+	defaultChunkOverlap = 30
+	defaultURLTemplate  = "{repo}/blob/{ref}/{path}#L{start_line}-L{end_line}"
+)
+
+// Source is a named set of files which are embedded into the vector database.
+type Source struct {
+	// Name is stored as "source" metadata on every document and can be used to
+	// filter queries
+	Name string `yaml:"name" json:"name"`
+
+	// Root is the directory the files of this source are read from
+	Root string `yaml:"root" json:"root"`
+
+	// Include are glob patterns relative to Root a file must match. When empty
+	// all files are included. "**" matches across directories.
+	Include []string `yaml:"include" json:"include"`
+
+	// Exclude are glob patterns relative to Root which skip matching files
+	Exclude []string `yaml:"exclude" json:"exclude"`
+
+	// FileTypes are the file extensions (without dot) which are indexed
+	FileTypes []string `yaml:"file_types" json:"file_types"`
+
+	// Chunking controls how files are split into documents
+	Chunking Chunking `yaml:"chunking" json:"chunking"`
+
+	// Repository is the URL of the upstream repository, available as {repo} in
+	// the URL template
+	Repository string `yaml:"repository" json:"repository"`
+
+	// Ref is the branch or tag of the upstream repository, available as {ref}
+	Ref string `yaml:"ref" json:"ref"`
+
+	// PathPrefix is prepended to the path relative to Root to get the path of
+	// the file inside the upstream repository
+	PathPrefix string `yaml:"path_prefix" json:"path_prefix"`
+
+	// URLTemplate is used to link to a chunk of the upstream file. It supports
+	// the placeholders {repo}, {ref}, {path}, {start_line} and {end_line}.
+	URLTemplate string `yaml:"url_template" json:"url_template"`
+
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+type Chunking struct {
+	// Size is the maximum amount of characters of a chunk
+	Size int `yaml:"size" json:"size"`
+
+	// Overlap is the amount of characters shared by two neighbouring chunks
+	Overlap int `yaml:"overlap" json:"overlap"`
+}
+
+// LoadSources reads the source registry from the given YAML file.
+func LoadSources(file string) ([]*Source, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sources file: %w", err)
+	}
+
+	var registry struct {
+		Sources []*Source `yaml:"sources"`
+	}
+
+	if err := yaml.Unmarshal(content, &registry); err != nil {
+		return nil, fmt.Errorf("failed to parse sources file %s: %w", file, err)
+	}
+
+	if len(registry.Sources) == 0 {
+		return nil, fmt.Errorf("no sources defined in %s", file)
+	}
+
+	names := make(map[string]struct{}, len(registry.Sources))
+
+	for _, source := range registry.Sources {
+		if source.Name == "" {
+			return nil, fmt.Errorf("source with root %q has no name", source.Root)
+		}
+
+		if _, ok := names[source.Name]; ok {
+			return nil, fmt.Errorf("source %s is defined twice", source.Name)
+		}
+		names[source.Name] = struct{}{}
+
+		if source.Root == "" {
+			return nil, fmt.Errorf("source %s has no root", source.Name)
+		}
+
+		if source.URLTemplate == "" && source.Repository != "" {
+			source.URLTemplate = defaultURLTemplate
+		}
+
+		if source.Chunking.Size <= 0 {
+			source.Chunking.Size = defaultChunkSize
+		}
+
+		if source.Chunking.Overlap <= 0 {
+			source.Chunking.Overlap = defaultChunkOverlap
+		}
+
+		for i, fileType := range source.FileTypes {
+			source.FileTypes[i] = strings.TrimPrefix(fileType, ".")
+		}
+
+		if source.include, err = compileGlobs(source.Include); err != nil {
+			return nil, fmt.Errorf("source %s: %w", source.Name, err)
+		}
+
+		if source.exclude, err = compileGlobs(source.Exclude); err != nil {
+			return nil, fmt.Errorf("source %s: %w", source.Name, err)
+		}
+	}
+
+	return registry.Sources, nil
+}
+
+// Matches reports whether the file at the slash separated path relative to
+// Root belongs to this source.
+func (s *Source) Matches(relPath string) bool {
+	if len(s.FileTypes) > 0 {
+		ext := strings.TrimPrefix(path.Ext(relPath), ".")
+		found := false
+
+		for _, fileType := range s.FileTypes {
+			if ext == fileType {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	for _, re := range s.exclude {
+		if re.MatchString(relPath) {
+			return false
+		}
+	}
+
+	if len(s.include) == 0 {
+		return true
+	}
+
+	for _, re := range s.include {
+		if re.MatchString(relPath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UpstreamPath returns the path of the file inside the upstream repository
+// for the slash separated path relative to Root.
+func (s *Source) UpstreamPath(relPath string) string {
+	return path.Join(s.PathPrefix, relPath)
+}
+
+// URL returns the link to the given lines of the file at the slash separated
+// path relative to Root. When the line range is unknown (zero) a fragment
+// referencing it is left out. GitHub links to lines of Markdown files point to
+// the source view. An empty string is returned when no template is
+// configured.
+func (s *Source) URL(relPath string, startLine, endLine int) string {
+	if s.URLTemplate == "" {
+		return ""
+	}
+
+	template := s.URLTemplate
+
+	if idx := strings.Index(template, "#"); idx != -1 && strings.Contains(template[idx:], "_line}") {
+		switch {
+		case startLine <= 0:
+			template = template[:idx]
+		case isMarkdown(relPath) && strings.Contains(template, "/blob/") && !strings.Contains(template[:idx], "?"):
+			// GitHub renders Markdown and ignores line anchors unless the
+			// source view is requested
+			template = template[:idx] + "?plain=1" + template[idx:]
+		}
+	}
+
+	return strings.NewReplacer(
+		"{repo}", strings.TrimSuffix(s.Repository, "/"),
+		"{ref}", s.Ref,
+		"{path}", s.UpstreamPath(relPath),
+		"{start_line}", strconv.Itoa(startLine),
+		"{end_line}", strconv.Itoa(endLine),
+	).Replace(template)
+}
+
+func isMarkdown(relPath string) bool {
+	switch strings.ToLower(path.Ext(relPath)) {
+	case ".md", ".markdown", ".mdx":
+		return true
+	}
+
+	return false
+}
+
+// Fingerprint identifies the settings of the source. Files have to be indexed
+// again when the fingerprint changes.
+func (s *Source) Fingerprint() string {
+	content, _ := json.Marshal(s)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// compileGlobs turns glob patterns into regular expressions. Besides the
+// wildcards supported by path.Match, "**" matches any number of directories.
+func compileGlobs(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		var expr strings.Builder
+		expr.WriteString("^")
+
+		for i := 0; i < len(pattern); i++ {
+			switch c := pattern[i]; c {
+			case '*':
+				if i+1 < len(pattern) && pattern[i+1] == '*' {
+					i++
+					if i+1 < len(pattern) && pattern[i+1] == '/' {
+						i++
+						expr.WriteString("(?:.*/)?")
+					} else {
+						expr.WriteString(".*")
+					}
+				} else {
+					expr.WriteString("[^/]*")
+				}
+			case '?':
+				expr.WriteString("[^/]")
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		}
+
+		expr.WriteString("$")
+
+		re, err := regexp.Compile(expr.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+
+		compiled = append(compiled, re)
+	}
+
+	return compiled, nil
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"net/http"
+
+	"github.com/charmbracelet/log"
+	"github.com/shopwarelabs/copilot-extension/signature"
+)
+
+// GetVerifier returns the verifier of the request signatures. In development
+// mode it accepts requests signed with the local key, otherwise the keys are
+// read from PublicKeysFile when set and fetched from GitHub when not.
+func GetVerifier(cfg *Info) (*signature.Verifier, error) {
+	if cfg.DevMode {
+		key, err := signature.LoadOrCreateDevKey(cfg.DevKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Warn("Development mode, only requests signed with the local key are accepted", "key", cfg.DevKeyFile)
+
+		return signature.NewVerifier(signature.DevKeys(key)), nil
+	}
+
+	if cfg.PublicKeysFile != "" {
+		return signature.NewVerifier(signature.FileKeys(cfg.PublicKeysFile)), nil
+	}
+
+	return signature.NewVerifier(signature.GitHubKeys(http.DefaultClient)), nil
+}
@@ -0,0 +1,108 @@
+package copilot
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+const (
+	retryMax     = 3
+	retryWaitMin = 500 * time.Millisecond
+	retryWaitMax = 10 * time.Second
+
+	// maxRetryAfter caps the delay a server may request, longer waits would
+	// leave the user without an answer
+	maxRetryAfter = 30 * time.Second
+)
+
+// NewClient returns the HTTP client used by the providers. It retries
+// connection errors, rate limited requests and server errors with an
+// exponential backoff and returns the last response when it gives up, so its
+// error body can be read.
+func NewClient() *retryablehttp.Client {
+	client := retryablehttp.NewClient()
+	client.RetryMax = retryMax
+	client.RetryWaitMin = retryWaitMin
+	client.RetryWaitMax = retryWaitMax
+	client.CheckRetry = checkRetry
+	client.Backoff = backoff
+	client.ErrorHandler = retryablehttp.PassthroughErrorHandler
+	client.Logger = retryLogger{}
+
+	return client
+}
+
+// checkRetry retries connection errors, 429 and 5xx responses except 501.
+func checkRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	if err != nil {
+		return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true, nil
+	}
+
+	return resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented, nil
+}
+
+// backoff waits as long as the Retry-After header asks for, up to
+// maxRetryAfter, and falls back to an exponential backoff without it.
+func backoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return wait
+		}
+	}
+
+	return retryablehttp.DefaultBackoff(min, max, attemptNum, resp)
+}
+
+// retryAfter parses a Retry-After header given in seconds or as HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+
+		return min(time.Duration(seconds)*time.Second, maxRetryAfter), true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return min(max(time.Until(date), 0), maxRetryAfter), true
+	}
+
+	return 0, false
+}
+
+// retryLogger passes the log messages of the retrying client to the default
+// logger.
+type retryLogger struct{}
+
+func (retryLogger) Error(msg string, keysAndValues ...interface{}) {
+	log.Error(msg, keysAndValues...)
+}
+
+func (retryLogger) Info(msg string, keysAndValues ...interface{}) {
+	log.Info(msg, keysAndValues...)
+}
+
+func (retryLogger) Debug(msg string, keysAndValues ...interface{}) {
+	log.Debug(msg, keysAndValues...)
+}
+
+func (retryLogger) Warn(msg string, keysAndValues ...interface{}) {
+	log.Warn(msg, keysAndValues...)
+}
@@ -1,8 +1,6 @@
 package copilot
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,34 +8,99 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/charmbracelet/log"
 	"github.com/hashicorp/go-retryablehttp"
 )
 
-func StreamChatCompletions(ctx context.Context, client *retryablehttp.Client, integrationID, apiKey string, req *ChatCompletionsRequest) (<-chan StreamResponse, error) {
+// Credentials authenticate a chat request. Copilot passes them with every
+// request to the agent, other providers may ignore them.
+type Credentials struct {
+	IntegrationID string
+	APIKey        string
+}
+
+// Provider streams chat completions from a chat backend.
+type Provider interface {
+	StreamChatCompletions(ctx context.Context, credentials Credentials, req *ChatCompletionsRequest) (<-chan StreamResponse, error)
+}
+
+// CopilotProvider uses the chat API of GitHub Copilot with the token of the
+// user the agent answers.
+type CopilotProvider struct {
+	client *retryablehttp.Client
+}
+
+func NewCopilotProvider(client *retryablehttp.Client) *CopilotProvider {
+	return &CopilotProvider{
+		client: client,
+	}
+}
+
+func (p *CopilotProvider) StreamChatCompletions(ctx context.Context, credentials Credentials, req *ChatCompletionsRequest) (<-chan StreamResponse, error) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+credentials.APIKey)
+	if credentials.IntegrationID != "" {
+		header.Set("Copilot-Integration-Id", credentials.IntegrationID)
+	}
+
+	return streamChatCompletions(ctx, p.client, "https://api.githubcopilot.com/chat/completions", header, req)
+}
+
+// OpenAIProvider uses an OpenAI compatible chat completions API, e.g. OpenAI,
+// Azure OpenAI, vLLM or LiteLLM. The configured API key replaces the
+// credentials of the request.
+type OpenAIProvider struct {
+	client  *retryablehttp.Client
+	baseURL string
+	apiKey  string
+}
+
+// NewOpenAIProvider creates a provider sending requests to
+// {baseURL}/chat/completions.
+func NewOpenAIProvider(client *retryablehttp.Client, baseURL, apiKey string) *OpenAIProvider {
+	return &OpenAIProvider{
+		client:  client,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+	}
+}
+
+func (p *OpenAIProvider) StreamChatCompletions(ctx context.Context, credentials Credentials, req *ChatCompletionsRequest) (<-chan StreamResponse, error) {
+	header := http.Header{}
+	if p.apiKey != "" {
+		header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	return streamChatCompletions(ctx, p.client, p.baseURL+"/chat/completions", header, req)
+}
+
+// streamChatCompletions sends an OpenAI style chat completions request and
+// streams the server sent events of the response. Malformed events are
+// skipped, error events end the stream with a StreamError.
+func streamChatCompletions(ctx context.Context, client *retryablehttp.Client, url string, header http.Header, req *ChatCompletionsRequest) (<-chan StreamResponse, error) {
 	body, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.githubcopilot.com/chat/completions", bytes.NewReader(body))
+	httpReq, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	for name, values := range header {
+		httpReq.Header[name] = values
+	}
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Accept", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
-	if integrationID != "" {
-		httpReq.Header.Set("Copilot-Integration-Id", integrationID)
-	}
 
-	resp, err := client.HTTPClient.Do(httpReq)
+	resp, err := client.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		defer resp.Body.Close()
+		return nil, newAPIError(resp)
 	}
 
 	responseChan := make(chan StreamResponse)
@@ -46,33 +109,47 @@ func StreamChatCompletions(ctx context.Context, client *retryablehttp.Client, in
 		defer resp.Body.Close()
 		defer close(responseChan)
 
-		reader := bufio.NewReader(resp.Body)
+		decoder := NewDecoder(resp.Body)
 		for {
-			line, err := reader.ReadString('\n')
+			event, err := decoder.Next()
 			if err != nil {
 				if err != io.EOF {
-					responseChan <- StreamResponse{Error: err}
+					send(ctx, responseChan, StreamResponse{Error: err})
 				}
 				return
 			}
 
-			line = strings.TrimSpace(line)
-			if line == "" || !strings.HasPrefix(line, "data: ") {
+			if event.Type == "error" {
+				send(ctx, responseChan, StreamResponse{Error: newStreamError(event.Data)})
+				return
+			}
+
+			if event.Type != "message" {
 				continue
 			}
 
-			data := strings.TrimPrefix(line, "data: ")
-			if data == "[DONE]" {
+			if event.Data == "[DONE]" {
 				return
 			}
 
-			var streamResp ChatCompletionsResponse
-			if err := json.Unmarshal([]byte(data), &streamResp); err != nil {
-				responseChan <- StreamResponse{Error: err}
+			var streamResp struct {
+				ChatCompletionsResponse
+				Error json.RawMessage `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(event.Data), &streamResp); err != nil {
+				log.Warn("skipping malformed chat completions event", "error", err)
+				continue
+			}
+
+			// Some APIs report errors as a regular message
+			if len(streamResp.Error) > 0 && string(streamResp.Error) != "null" {
+				send(ctx, responseChan, StreamResponse{Error: newStreamError(event.Data)})
 				return
 			}
 
-			responseChan <- StreamResponse{Response: &streamResp}
+			if !send(ctx, responseChan, StreamResponse{Response: &streamResp.ChatCompletionsResponse}) {
+				return
+			}
 		}
 	}()
 
@@ -83,3 +160,14 @@ type StreamResponse struct {
 	Response *ChatCompletionsResponse
 	Error    error
 }
+
+// send passes a response to the consumer of the stream. It gives up when the
+// context is done, as the consumer may have stopped reading.
+func send(ctx context.Context, responses chan<- StreamResponse, resp StreamResponse) bool {
+	select {
+	case responses <- resp:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
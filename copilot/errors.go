@@ -0,0 +1,120 @@
+package copilot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBodySize limits how much of an error response is read.
+const maxErrorBodySize = 64 * 1024
+
+// APIError is an error response of a chat API.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("chat API returned status %d (%s): %s", e.StatusCode, e.Code, e.Message)
+	}
+
+	return fmt.Sprintf("chat API returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// StreamError is an error the chat API reported within a stream, after it
+// already answered with status 200.
+type StreamError struct {
+	Code    string
+	Message string
+}
+
+func (e *StreamError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("chat API stream failed (%s): %s", e.Code, e.Message)
+	}
+
+	return fmt.Sprintf("chat API stream failed: %s", e.Message)
+}
+
+// newAPIError reads the error of a response.
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+	}
+	apiErr.Code, apiErr.Message = parseError(body)
+
+	if apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+
+	return apiErr
+}
+
+// newStreamError reads the payload of an error event.
+func newStreamError(data string) *StreamError {
+	streamErr := &StreamError{}
+	streamErr.Code, streamErr.Message = parseError([]byte(data))
+
+	if streamErr.Message == "" {
+		streamErr.Message = strings.TrimSpace(data)
+	}
+
+	if streamErr.Message == "" {
+		streamErr.Message = "unknown error"
+	}
+
+	return streamErr
+}
+
+// parseError reads the code and message of an error payload. It understands
+// the OpenAI format {"error": {"code": ..., "message": ...}}, the Ollama
+// format {"error": "..."} and {"message": ...}. The message is empty for
+// other payloads.
+func parseError(body []byte) (code, message string) {
+	var errorBody struct {
+		Error   json.RawMessage `json:"error"`
+		Code    any             `json:"code"`
+		Message string          `json:"message"`
+	}
+
+	if err := json.Unmarshal(body, &errorBody); err != nil {
+		return "", ""
+	}
+
+	var detail struct {
+		Code    any    `json:"code"`
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	}
+
+	switch {
+	case json.Unmarshal(errorBody.Error, &detail) == nil && detail.Message != "":
+		code = detail.Type
+		if detail.Code != nil {
+			code = fmt.Sprint(detail.Code)
+		}
+
+		return code, detail.Message
+	case json.Unmarshal(errorBody.Error, &message) == nil && message != "":
+		return "", message
+	case errorBody.Message != "":
+		if errorBody.Code != nil {
+			code = fmt.Sprint(errorBody.Code)
+		}
+
+		return code, errorBody.Message
+	}
+
+	return "", ""
+}
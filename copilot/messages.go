@@ -4,16 +4,26 @@ import "github.com/invopop/jsonschema"
 
 type ChatRequest struct {
 	Messages []ChatMessage `json:"messages"`
+
+	// Model is the model the client asks for, empty when it has no preference
+	Model Model `json:"model,omitempty"`
 }
 
 type ChatMessage struct {
 	Role          string              `json:"role"`
 	Content       string              `json:"content"`
-	Confirmations []*ChatConfirmation `json:"copilot_confirmations"`
-	ToolCalls     []*ToolCall         `json:"tool_calls"`
+	Confirmations []*ChatConfirmation `json:"copilot_confirmations,omitempty"`
+
+	// ToolCalls are the functions an assistant message asks to call
+	ToolCalls []*ToolCall `json:"tool_calls,omitempty"`
+
+	// ToolCallID is the ID of the call a message with role "tool" answers
+	ToolCallID string `json:"tool_call_id,omitempty"`
 }
 
 type ToolCall struct {
+	ID       string                   `json:"id"`
+	Type     string                   `json:"type"`
 	Function *ChatMessageFunctionCall `json:"function"`
 }
 
@@ -39,7 +49,7 @@ type Model string
 const (
 	ModelGPT35      Model = "gpt-3.5-turbo"
 	ModelGPT4       Model = "gpt-4"
-	ModelGPT4O      Model = "gpt-40"
+	ModelGPT4O      Model = "gpt-4o"
 	ModelEmbeddings Model = "text-embedding-ada-002"
 )
 
@@ -62,48 +72,78 @@ type Function struct {
 }
 
 type ChatCompletionsResponse struct {
-	Choices []struct {
-		FinishReason         string `json:"finish_reason"`
-		Index                int    `json:"index"`
-		ContentFilterOffsets struct {
-			CheckOffset int `json:"check_offset"`
-			StartOffset int `json:"start_offset"`
-			EndOffset   int `json:"end_offset"`
-		} `json:"content_filter_offsets"`
-		ContentFilterResults struct {
-			Error struct {
-				Code    string `json:"code"`
-				Message string `json:"message"`
-			} `json:"error"`
-			Hate struct {
-				Filtered bool   `json:"filtered"`
-				Severity string `json:"severity"`
-			} `json:"hate"`
-			SelfHarm struct {
-				Filtered bool   `json:"filtered"`
-				Severity string `json:"severity"`
-			} `json:"self_harm"`
-			Sexual struct {
-				Filtered bool   `json:"filtered"`
-				Severity string `json:"severity"`
-			} `json:"sexual"`
-			Violence struct {
-				Filtered bool   `json:"filtered"`
-				Severity string `json:"severity"`
-			} `json:"violence"`
-		} `json:"content_filter_results"`
-		Delta struct {
-			Content   string `json:"content"`
-			ToolCalls []struct {
-				Function *ChatMessageFunctionCall `json:"function"`
-				ID       string                   `json:"id"`
-				Index    int                      `json:"index"`
-				Type     string                   `json:"type"`
-			} `json:"tool_calls"`
-		} `json:"delta"`
-	} `json:"choices"`
-	Created           int    `json:"created"`
-	ID                string `json:"id"`
-	Model             string `json:"model"`
-	SystemFingerprint string `json:"system_fingerprint"`
+	Choices           []ChatCompletionsChoice `json:"choices"`
+	Created           int                     `json:"created"`
+	ID                string                  `json:"id"`
+	Model             string                  `json:"model"`
+	SystemFingerprint string                  `json:"system_fingerprint"`
+}
+
+type ChatCompletionsChoice struct {
+	FinishReason         string `json:"finish_reason"`
+	Index                int    `json:"index"`
+	ContentFilterOffsets struct {
+		CheckOffset int `json:"check_offset"`
+		StartOffset int `json:"start_offset"`
+		EndOffset   int `json:"end_offset"`
+	} `json:"content_filter_offsets"`
+	ContentFilterResults struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+		Hate struct {
+			Filtered bool   `json:"filtered"`
+			Severity string `json:"severity"`
+		} `json:"hate"`
+		SelfHarm struct {
+			Filtered bool   `json:"filtered"`
+			Severity string `json:"severity"`
+		} `json:"self_harm"`
+		Sexual struct {
+			Filtered bool   `json:"filtered"`
+			Severity string `json:"severity"`
+		} `json:"sexual"`
+		Violence struct {
+			Filtered bool   `json:"filtered"`
+			Severity string `json:"severity"`
+		} `json:"violence"`
+	} `json:"content_filter_results"`
+	Delta ChatCompletionsDelta `json:"delta"`
+}
+
+// FilteredCategories returns the content filter categories which removed
+// content from the choice.
+func (c ChatCompletionsChoice) FilteredCategories() []string {
+	results := c.ContentFilterResults
+
+	var categories []string
+	if results.Hate.Filtered {
+		categories = append(categories, "hate")
+	}
+	if results.SelfHarm.Filtered {
+		categories = append(categories, "self_harm")
+	}
+	if results.Sexual.Filtered {
+		categories = append(categories, "sexual")
+	}
+	if results.Violence.Filtered {
+		categories = append(categories, "violence")
+	}
+
+	return categories
+}
+
+type ChatCompletionsDelta struct {
+	Content   string          `json:"content"`
+	ToolCalls []ToolCallDelta `json:"tool_calls"`
+}
+
+// ToolCallDelta is a part of a tool call streamed by the model. The parts
+// with the same Index belong to the same call.
+type ToolCallDelta struct {
+	Function *ChatMessageFunctionCall `json:"function"`
+	ID       string                   `json:"id"`
+	Index    int                      `json:"index"`
+	Type     string                   `json:"type"`
 }
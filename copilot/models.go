@@ -0,0 +1,63 @@
+package copilot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// ModelInfo describes a model offered by the Copilot API.
+type ModelInfo struct {
+	ID           Model  `json:"id"`
+	Name         string `json:"name"`
+	Vendor       string `json:"vendor"`
+	Version      string `json:"version"`
+	Capabilities struct {
+		Type   string `json:"type"`
+		Family string `json:"family"`
+		Limits struct {
+			MaxContextWindowTokens int `json:"max_context_window_tokens"`
+			MaxPromptTokens        int `json:"max_prompt_tokens"`
+			MaxOutputTokens        int `json:"max_output_tokens"`
+		} `json:"limits"`
+		Supports struct {
+			ToolCalls bool `json:"tool_calls"`
+			Streaming bool `json:"streaming"`
+		} `json:"supports"`
+	} `json:"capabilities"`
+}
+
+// ListModels returns the models the Copilot API offers for the given token.
+func ListModels(ctx context.Context, client *retryablehttp.Client, integrationID, apiKey string) ([]ModelInfo, error) {
+	httpReq, err := retryablehttp.NewRequestWithContext(ctx, http.MethodGet, "https://api.githubcopilot.com/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	if integrationID != "" {
+		httpReq.Header.Set("Copilot-Integration-Id", integrationID)
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var respBody struct {
+		Data []ModelInfo `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+		return nil, fmt.Errorf("failed to decode models: %w", err)
+	}
+
+	return respBody.Data, nil
+}
@@ -0,0 +1,182 @@
+package copilot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// OllamaProvider uses the chat API of Ollama, which streams newline delimited
+// JSON instead of server sent events.
+type OllamaProvider struct {
+	client  *retryablehttp.Client
+	baseURL string
+}
+
+// NewOllamaProvider creates a provider sending requests to {baseURL}/chat,
+// e.g. http://localhost:11434/api/chat.
+func NewOllamaProvider(client *retryablehttp.Client, baseURL string) *OllamaProvider {
+	return &OllamaProvider{
+		client:  client,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+type ollamaChatRequest struct {
+	Model    Model               `json:"model"`
+	Messages []ollamaChatMessage `json:"messages"`
+	Tools    []FunctionTool      `json:"tools,omitempty"`
+	Stream   bool                `json:"stream"`
+}
+
+type ollamaChatMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+// ollamaToolCall differs from the OpenAI format by passing the arguments as
+// object instead of a JSON encoded string.
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaChatResponse struct {
+	Model      string            `json:"model"`
+	Message    ollamaChatMessage `json:"message"`
+	Done       bool              `json:"done"`
+	DoneReason string            `json:"done_reason"`
+	Error      string            `json:"error"`
+}
+
+func (p *OllamaProvider) StreamChatCompletions(ctx context.Context, credentials Credentials, req *ChatCompletionsRequest) (<-chan StreamResponse, error) {
+	ollamaReq := ollamaChatRequest{
+		Model:  req.Model,
+		Tools:  req.Tools,
+		Stream: true,
+	}
+
+	for _, msg := range req.Messages {
+		ollamaMsg := ollamaChatMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		}
+
+		for _, call := range msg.ToolCalls {
+			var toolCall ollamaToolCall
+			toolCall.Function.Name = call.Function.Name
+			toolCall.Function.Arguments = json.RawMessage(call.Function.Arguments)
+
+			if !json.Valid(toolCall.Function.Arguments) {
+				toolCall.Function.Arguments = json.RawMessage("{}")
+			}
+
+			ollamaMsg.ToolCalls = append(ollamaMsg.ToolCalls, toolCall)
+		}
+
+		ollamaReq.Messages = append(ollamaReq.Messages, ollamaMsg)
+	}
+
+	body, err := json.Marshal(ollamaReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/chat", body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, newAPIError(resp)
+	}
+
+	responseChan := make(chan StreamResponse)
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(responseChan)
+
+		toolCalls := 0
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			var chunk ollamaChatResponse
+			if err := json.Unmarshal(line, &chunk); err != nil {
+				send(ctx, responseChan, StreamResponse{Error: err})
+				return
+			}
+
+			if chunk.Error != "" {
+				send(ctx, responseChan, StreamResponse{Error: &StreamError{Message: chunk.Error}})
+				return
+			}
+
+			choice := ChatCompletionsChoice{
+				Delta: ChatCompletionsDelta{
+					Content: chunk.Message.Content,
+				},
+			}
+
+			// Ollama sends every tool call in one piece
+			for _, call := range chunk.Message.ToolCalls {
+				choice.Delta.ToolCalls = append(choice.Delta.ToolCalls, ToolCallDelta{
+					ID:    fmt.Sprintf("call_%d", toolCalls),
+					Index: toolCalls,
+					Type:  "function",
+					Function: &ChatMessageFunctionCall{
+						Name:      call.Function.Name,
+						Arguments: string(call.Function.Arguments),
+					},
+				})
+				toolCalls++
+			}
+
+			if chunk.Done {
+				choice.FinishReason = chunk.DoneReason
+				if toolCalls > 0 {
+					choice.FinishReason = "tool_calls"
+				}
+			}
+
+			if !send(ctx, responseChan, StreamResponse{Response: &ChatCompletionsResponse{
+				Model:   chunk.Model,
+				Choices: []ChatCompletionsChoice{choice},
+			}}) {
+				return
+			}
+
+			if chunk.Done {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			send(ctx, responseChan, StreamResponse{Error: err})
+		}
+	}()
+
+	return responseChan, nil
+}
@@ -0,0 +1,142 @@
+package copilot
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxEventLineSize limits the length of a single line of an event stream.
+const maxEventLineSize = 4 * 1024 * 1024
+
+// Event is a server sent event.
+type Event struct {
+	// Type is the event name, "message" when the stream didn't name it
+	Type string
+
+	// Data is the payload, the data lines of the event joined by newlines
+	Data string
+
+	// ID is the last event ID the stream has set
+	ID string
+
+	// Retry is the reconnection time the stream asks for, zero when not set
+	Retry time.Duration
+}
+
+// Decoder reads server sent events as specified by the HTML standard. Lines
+// may end with CRLF, LF or CR. Comments, used as heartbeats, and unknown
+// fields are skipped.
+type Decoder struct {
+	scanner *bufio.Scanner
+	id      string
+	retry   time.Duration
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEventLineSize)
+	scanner.Split(scanLines)
+
+	return &Decoder{
+		scanner: scanner,
+	}
+}
+
+// Next returns the next event of the stream. It returns io.EOF at the end of
+// the stream, an unterminated event at the end is discarded.
+func (d *Decoder) Next() (*Event, error) {
+	var (
+		eventType string
+		data      strings.Builder
+		hasData   bool
+	)
+
+	for d.scanner.Scan() {
+		line := d.scanner.Text()
+
+		// An empty line dispatches the event
+		if line == "" {
+			if !hasData {
+				eventType = ""
+				continue
+			}
+
+			if eventType == "" {
+				eventType = "message"
+			}
+
+			return &Event{
+				Type:  eventType,
+				Data:  strings.TrimSuffix(data.String(), "\n"),
+				ID:    d.id,
+				Retry: d.retry,
+			}, nil
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, found := strings.Cut(line, ":")
+		if found {
+			value = strings.TrimPrefix(value, " ")
+		}
+
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				d.id = value
+			}
+		case "retry":
+			if milliseconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+				d.retry = time.Duration(milliseconds) * time.Millisecond
+			}
+		}
+	}
+
+	if err := d.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+// scanLines splits the stream into lines ending with CRLF, LF or CR.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+
+		// A CR at the end of the buffer may be followed by a LF
+		if i+1 == len(data) && !atEOF {
+			return 0, nil, nil
+		}
+
+		if i+1 < len(data) && data[i+1] == '\n' {
+			return i + 2, data[:i], nil
+		}
+
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
@@ -0,0 +1,246 @@
+package copilot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decodeAll(t testing.TB, input string) []Event {
+	t.Helper()
+
+	decoder := NewDecoder(strings.NewReader(input))
+
+	var events []Event
+	for {
+		event, err := decoder.Next()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		events = append(events, *event)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		events []Event
+	}{
+		{
+			name:   "lf",
+			input:  "data: one\n\ndata: two\n\n",
+			events: []Event{{Type: "message", Data: "one"}, {Type: "message", Data: "two"}},
+		},
+		{
+			name:   "crlf",
+			input:  "data: one\r\n\r\ndata: two\r\n\r\n",
+			events: []Event{{Type: "message", Data: "one"}, {Type: "message", Data: "two"}},
+		},
+		{
+			name:   "cr",
+			input:  "data: one\r\rdata: two\r\r",
+			events: []Event{{Type: "message", Data: "one"}, {Type: "message", Data: "two"}},
+		},
+		{
+			name:   "mixed line endings",
+			input:  "data: one\r\n\ndata: two\r\r\n",
+			events: []Event{{Type: "message", Data: "one"}, {Type: "message", Data: "two"}},
+		},
+		{
+			name:   "multi-line data",
+			input:  "data: first\ndata: second\ndata\n\n",
+			events: []Event{{Type: "message", Data: "first\nsecond\n"}},
+		},
+		{
+			name:   "value without space",
+			input:  "data:value\n\n",
+			events: []Event{{Type: "message", Data: "value"}},
+		},
+		{
+			name:   "event name",
+			input:  "event: error\ndata: {}\n\ndata: next\n\n",
+			events: []Event{{Type: "error", Data: "{}"}, {Type: "message", Data: "next"}},
+		},
+		{
+			name:  "id and retry",
+			input: "id: 1\nretry: 1500\ndata: one\n\ndata: two\n\nid\ndata: three\n\n",
+			events: []Event{
+				{Type: "message", Data: "one", ID: "1", Retry: 1500 * time.Millisecond},
+				{Type: "message", Data: "two", ID: "1", Retry: 1500 * time.Millisecond},
+				{Type: "message", Data: "three", ID: "", Retry: 1500 * time.Millisecond},
+			},
+		},
+		{
+			name:   "invalid retry",
+			input:  "retry: soon\ndata: one\n\n",
+			events: []Event{{Type: "message", Data: "one"}},
+		},
+		{
+			name:   "comment heartbeats",
+			input:  ": keep-alive\n\n:\ndata: one\n: in between\n\n",
+			events: []Event{{Type: "message", Data: "one"}},
+		},
+		{
+			name:   "event without data",
+			input:  "event: ping\n\ndata: one\n\n",
+			events: []Event{{Type: "message", Data: "one"}},
+		},
+		{
+			name:   "unknown field",
+			input:  "foo: bar\ndata: one\n\n",
+			events: []Event{{Type: "message", Data: "one"}},
+		},
+		{
+			name:   "unterminated final event",
+			input:  "data: one\n\ndata: two",
+			events: []Event{{Type: "message", Data: "one"}},
+		},
+		{
+			name:   "unterminated final event with newline",
+			input:  "data: one\n\ndata: two\n",
+			events: []Event{{Type: "message", Data: "one"}},
+		},
+		{
+			name:  "empty",
+			input: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := decodeAll(t, tt.input)
+
+			if !reflect.DeepEqual(events, tt.events) {
+				t.Errorf("got %#v, want %#v", events, tt.events)
+			}
+		})
+	}
+}
+
+func TestStreamChatCompletions(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		contents []string
+		err      *StreamError
+	}{
+		{
+			name:     "done",
+			body:     ": heartbeat\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\r\n\r\ndata: [DONE]\n\n",
+			contents: []string{"Hello"},
+		},
+		{
+			name:     "error event",
+			body:     "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\nevent: error\ndata: {\"error\":{\"code\":\"rate_limited\",\"message\":\"Too many requests\"}}\n\n",
+			contents: []string{"Hello"},
+			err:      &StreamError{Code: "rate_limited", Message: "Too many requests"},
+		},
+		{
+			name: "error payload",
+			body: "data: {\"error\":{\"code\":\"server_error\",\"message\":\"Overloaded\"}}\n\n",
+			err:  &StreamError{Code: "server_error", Message: "Overloaded"},
+		},
+		{
+			name:     "malformed event",
+			body:     "data: {\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n",
+			contents: []string{"Hello"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			stream, err := streamChatCompletions(context.Background(), NewClient(), server.URL, nil, &ChatCompletionsRequest{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var (
+				contents  []string
+				streamErr error
+			)
+			for resp := range stream {
+				if resp.Error != nil {
+					streamErr = resp.Error
+					continue
+				}
+
+				for _, choice := range resp.Response.Choices {
+					contents = append(contents, choice.Delta.Content)
+				}
+			}
+
+			if !reflect.DeepEqual(contents, tt.contents) {
+				t.Errorf("got contents %q, want %q", contents, tt.contents)
+			}
+
+			if tt.err == nil {
+				if streamErr != nil {
+					t.Errorf("unexpected error: %v", streamErr)
+				}
+				return
+			}
+
+			var got *StreamError
+			if !errors.As(streamErr, &got) {
+				t.Fatalf("got error %v, want a *StreamError", streamErr)
+			}
+
+			if *got != *tt.err {
+				t.Errorf("got %#v, want %#v", got, tt.err)
+			}
+		})
+	}
+}
+
+func FuzzDecoder(f *testing.F) {
+	f.Add("data: one\n\ndata: two\n\n")
+	f.Add("event: error\r\ndata: {}\r\n\r\n")
+	f.Add("id: 1\rretry: 100\rdata: a\rdata: b\r\r")
+	f.Add(": heartbeat\n\ndata")
+	f.Add("data:\n\n\r\n\r")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		events := decodeAll(t, input)
+
+		// Every event needs at least a data line and the empty line dispatching it
+		if lines := strings.Count(input, "\n") + strings.Count(input, "\r"); len(events) > lines/2 {
+			t.Fatalf("got %d events from %d line breaks", len(events), lines)
+		}
+
+		for _, event := range events {
+			if event.Type == "" {
+				t.Fatalf("event without type: %#v", event)
+			}
+
+			if strings.ContainsAny(event.Data, "\r") || strings.ContainsAny(event.Type+event.ID, "\r\n") {
+				t.Fatalf("event contains a line break: %#v", event)
+			}
+		}
+
+		// Without CRs, the stream must decode the same with CRLF line endings
+		if !strings.Contains(input, "\r") {
+			crlf := decodeAll(t, strings.ReplaceAll(input, "\n", "\r\n"))
+
+			if !reflect.DeepEqual(events, crlf) {
+				t.Fatalf("LF and CRLF streams differ: %#v != %#v", events, crlf)
+			}
+		}
+	})
+}
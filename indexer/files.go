@@ -0,0 +1,59 @@
+package indexer
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/shopwarelabs/copilot-extension/config"
+)
+
+// File is a file on disk which belongs to a source.
+type File struct {
+	// Path is the path on disk, it is also used as prefix of the document IDs
+	Path string
+
+	// RelPath is the slash separated path relative to the source root
+	RelPath string
+
+	Source *config.Source
+}
+
+// FindFiles walks the root of every source and returns the files matching it.
+func FindFiles(sources []*config.Source) ([]File, error) {
+	files := make([]File, 0)
+
+	for _, source := range sources {
+		err := filepath.WalkDir(source.Root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() {
+				return nil
+			}
+
+			rel, err := filepath.Rel(source.Root, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+
+			if source.Matches(rel) {
+				files = append(files, File{
+					Path:    path,
+					RelPath: rel,
+					Source:  source,
+				})
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk source %s: %w", source.Name, err)
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,45 @@
+package indexer
+
+import "strings"
+
+// LineLocator finds the line ranges of chunks inside the file they were split
+// from. Chunks have to be located in the order they were produced.
+type LineLocator struct {
+	content string
+	offset  int
+}
+
+func NewLineLocator(content string) *LineLocator {
+	return &LineLocator{
+		content: content,
+	}
+}
+
+// Locate returns the first and last line (1-based) of chunk. Zero is returned
+// for both when the chunk cannot be found, e.g. because the splitter changed
+// its whitespace.
+func (l *LineLocator) Locate(chunk string) (int, int) {
+	chunk = strings.TrimSpace(chunk)
+	if chunk == "" {
+		return 0, 0
+	}
+
+	idx := strings.Index(l.content[l.offset:], chunk)
+	if idx == -1 {
+		// Chunks may overlap, so retry from the beginning of the file
+		idx = strings.Index(l.content, chunk)
+		if idx == -1 {
+			return 0, 0
+		}
+	} else {
+		idx += l.offset
+	}
+
+	// The next chunk starts after the beginning of this one at the earliest
+	l.offset = idx + 1
+
+	start := strings.Count(l.content[:idx], "\n") + 1
+	end := start + strings.Count(chunk, "\n")
+
+	return start, end
+}
@@ -0,0 +1,153 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Manifest keeps track of which chunks have been created from which file. It
+// is persisted next to the vector database so that an index run can skip files
+// that did not change and prune chunks of files that were removed or shrank.
+type Manifest struct {
+	path string
+
+	mu    sync.Mutex
+	files map[string]ManifestEntry
+}
+
+// ManifestEntry describes the indexed state of a single file.
+type ManifestEntry struct {
+	// Hash is the content hash of the file at the time it was indexed
+	Hash string `json:"hash"`
+
+	// Source is the fingerprint of the source settings the file was indexed with
+	Source string `json:"source,omitempty"`
+
+	// Splitter is the SplitterVersion the file was split with
+	Splitter int `json:"splitter,omitempty"`
+
+	// Chunks are the document IDs stored in the collection for this file
+	Chunks []string `json:"chunks"`
+}
+
+// LoadManifest reads the manifest at path. A missing file results in an empty
+// manifest, which causes every file to be indexed again.
+func LoadManifest(path string) (*Manifest, error) {
+	m := &Manifest{
+		path:  path,
+		files: make(map[string]ManifestEntry),
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return m, nil
+		}
+
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	if err := json.Unmarshal(content, &m.files); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+
+	return m, nil
+}
+
+// Get returns the entry of the given file, if the file has been indexed before.
+func (m *Manifest) Get(file string) (ManifestEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.files[file]
+	return entry, ok
+}
+
+// Set records the indexed state of the given file.
+func (m *Manifest) Set(file string, entry ManifestEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files[file] = entry
+}
+
+// Remove forgets the given file.
+func (m *Manifest) Remove(file string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.files, file)
+}
+
+// Files returns all file names known to the manifest in sorted order.
+func (m *Manifest) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	files := make([]string, 0, len(m.files))
+	for file := range m.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	return files
+}
+
+// Save writes the manifest back to disk. The file is replaced atomically so an
+// interrupted run never leaves a truncated manifest behind.
+func (m *Manifest) Save() error {
+	m.mu.Lock()
+	content, err := json.MarshalIndent(m.files, "", "  ")
+	m.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := os.Rename(tmp, m.path); err != nil {
+		return fmt.Errorf("failed to replace manifest: %w", err)
+	}
+
+	return nil
+}
+
+// StaleChunks returns the chunk IDs of previous which are no longer part of
+// current.
+func StaleChunks(previous, current []string) []string {
+	keep := make(map[string]struct{}, len(current))
+	for _, id := range current {
+		keep[id] = struct{}{}
+	}
+
+	var stale []string
+	for _, id := range previous {
+		if _, ok := keep[id]; !ok {
+			stale = append(stale, id)
+		}
+	}
+
+	return stale
+}
+
+// HashContent returns the hex encoded SHA-256 hash of content.
+func HashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,109 @@
+package indexer
+
+import "strings"
+
+// skipLiteral returns the offset after the string or comment starting at i in
+// C-like source code, or i when there is none. With hashComments "#" starts
+// a line comment as in PHP, except for attributes ("#[").
+func skipLiteral(src string, i int, hashComments bool) int {
+	switch src[i] {
+	case '"', '\'', '`':
+		quote := src[i]
+
+		for j := i + 1; j < len(src); j++ {
+			if src[j] == '\\' {
+				j++
+				continue
+			}
+
+			if src[j] == quote {
+				return j + 1
+			}
+		}
+
+		return len(src)
+	case '/':
+		if i+1 >= len(src) {
+			return i
+		}
+
+		// "//" inside unquoted values like url(http://...) is no comment
+		if src[i+1] == '/' && (i == 0 || strings.IndexByte(" \t\r\n;{}", src[i-1]) != -1) {
+			return lineEnd(src, i)
+		}
+
+		if src[i+1] == '*' {
+			end := strings.Index(src[i+2:], "*/")
+			if end == -1 {
+				return len(src)
+			}
+
+			return i + 2 + end + 2
+		}
+	case '#':
+		if hashComments && (i+1 >= len(src) || src[i+1] != '[') {
+			return lineEnd(src, i)
+		}
+	}
+
+	return i
+}
+
+// matchingBrace returns the offset of the brace closing the one at open, or
+// the end of src when it is never closed.
+func matchingBrace(src string, open int, hashComments bool) int {
+	depth := 0
+
+	for i := open; i < len(src); {
+		if next := skipLiteral(src, i, hashComments); next != i {
+			i = next
+			continue
+		}
+
+		switch src[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+
+		i++
+	}
+
+	return len(src)
+}
+
+// lineEnd returns the offset of the newline ending the line containing i, or
+// the end of src.
+func lineEnd(src string, i int) int {
+	end := strings.IndexByte(src[i:], '\n')
+	if end == -1 {
+		return len(src)
+	}
+
+	return i + end
+}
+
+// leadingDocs moves start backwards over the doc comments and attributes
+// directly preceding the declaration starting at start.
+func leadingDocs(src string, start int) int {
+	for {
+		prev := strings.TrimRight(src[:start], " \t\r\n")
+
+		switch {
+		case strings.HasSuffix(prev, "*/"):
+			open := strings.LastIndex(prev, "/*")
+			if open == -1 {
+				return start
+			}
+			start = lineStart(src, open)
+		case strings.HasSuffix(prev, "]") && strings.HasPrefix(strings.TrimSpace(src[lineStart(src, len(prev)-1):len(prev)]), "#["):
+			start = lineStart(src, len(prev)-1)
+		default:
+			return start
+		}
+	}
+}
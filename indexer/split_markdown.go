@@ -0,0 +1,183 @@
+package indexer
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	markdownFrontmatterRegexp = regexp.MustCompile(`(?s)^---\n(.*?)---\n`)
+	markdownHeadingRegexp     = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+)
+
+// markdownSplitter creates one chunk per heading section. Headings without
+// content are joined with the next section. The frontmatter is stored as
+// metadata and every chunk is prefixed with its breadcrumb, built from the
+// directories of the file, its title and the headings above the section.
+type markdownSplitter struct {
+	fileName string
+}
+
+// markdownFrontmatter are the fields of the frontmatter used by the Shopware
+// documentation.
+type markdownFrontmatter struct {
+	Title string `yaml:"title"`
+	Nav   struct {
+		Title    string `yaml:"title"`
+		Position any    `yaml:"position"`
+	} `yaml:"nav"`
+	Tags []string `yaml:"tags"`
+}
+
+func (s markdownSplitter) Split(content string) ([]Chunk, error) {
+	start := 0
+	metadata := map[string]string{}
+
+	var frontmatter markdownFrontmatter
+
+	if match := markdownFrontmatterRegexp.FindStringSubmatchIndex(content); match != nil {
+		start = match[1]
+
+		// Broken frontmatter must not prevent the document from being indexed
+		_ = yaml.Unmarshal([]byte(content[match[2]:match[3]]), &frontmatter)
+	}
+
+	if frontmatter.Nav.Title != "" {
+		metadata["nav_title"] = frontmatter.Nav.Title
+	}
+
+	if frontmatter.Nav.Position != nil {
+		metadata["nav_position"] = fmt.Sprint(frontmatter.Nav.Position)
+	}
+
+	if len(frontmatter.Tags) > 0 {
+		metadata["tags"] = strings.Join(frontmatter.Tags, ",")
+	}
+
+	title := frontmatter.Title
+	if title == "" {
+		title = frontmatter.Nav.Title
+	}
+
+	if title != "" {
+		metadata["title"] = title
+	}
+
+	var chunks []Chunk
+
+	// headings holds the current heading of each level, index 0 is "#"
+	var headings [6]string
+
+	sectionStart := start
+	hasBody := false
+	inFence := false
+
+	flush := func(end int) {
+		chunk, ok := chunkAt(content, sectionStart, end, nil)
+		if !ok {
+			return
+		}
+
+		breadcrumb := s.breadcrumb(title, headings[:])
+		chunk.Context = breadcrumb
+
+		chunk.Metadata = make(map[string]string, len(metadata)+2)
+		for key, value := range metadata {
+			chunk.Metadata[key] = value
+		}
+
+		if breadcrumb != "" {
+			chunk.Metadata["breadcrumb"] = breadcrumb
+		}
+
+		for level := len(headings) - 1; level >= 0; level-- {
+			if headings[level] != "" {
+				chunk.Metadata["heading"] = headings[level]
+				break
+			}
+		}
+
+		chunks = append(chunks, chunk)
+	}
+
+	for offset := start; offset < len(content); {
+		end := lineEnd(content, offset)
+		line := content[offset:end]
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+
+		if match := markdownHeadingRegexp.FindStringSubmatch(line); match != nil && !inFence {
+			if hasBody {
+				flush(offset)
+				sectionStart = offset
+				hasBody = false
+			}
+
+			level := len(match[1]) - 1
+			headings[level] = match[2]
+			for deeper := level + 1; deeper < len(headings); deeper++ {
+				headings[deeper] = ""
+			}
+		} else if trimmed != "" {
+			hasBody = true
+		}
+
+		offset = end + 1
+	}
+
+	flush(len(content))
+
+	return chunks, nil
+}
+
+// breadcrumb joins the directories of the file, the title and the headings
+// with " > ", e.g. "Guides > Plugins > Plugin Base Guide > Installation".
+func (s markdownSplitter) breadcrumb(title string, headings []string) string {
+	var parts []string
+
+	add := func(part string) {
+		part = strings.TrimSpace(part)
+		if part == "" || (len(parts) > 0 && strings.EqualFold(parts[len(parts)-1], part)) {
+			return
+		}
+		parts = append(parts, part)
+	}
+
+	if dir := path.Dir(s.fileName); dir != "." && dir != "/" {
+		for _, segment := range strings.Split(dir, "/") {
+			add(humanize(segment))
+		}
+	}
+
+	add(title)
+
+	for _, heading := range headings {
+		add(heading)
+	}
+
+	return strings.Join(parts, " > ")
+}
+
+// humanize turns a file or directory name like "plugin-base-guide" into
+// "Plugin Base Guide".
+func humanize(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '-' || r == '_' || r == ' '
+	})
+
+	for i, word := range words {
+		first, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToUpper(first)) + word[size:]
+	}
+
+	return strings.Join(words, " ")
+}
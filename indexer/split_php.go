@@ -0,0 +1,165 @@
+package indexer
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	phpNamespaceRegexp = regexp.MustCompile(`(?m)^namespace\s+([^;{\s]+)`)
+	phpClassRegexp     = regexp.MustCompile(`(?m)^[ \t]*(?:(?:abstract|final|readonly)\s+)*(class|interface|trait|enum)\s+(\w+)[^{;]*\{`)
+	phpFunctionRegexp  = regexp.MustCompile(`(?m)^[ \t]*(?:(?:public|protected|private|static|abstract|final)\s+)*function\s+&?(\w+)\s*\(`)
+)
+
+// phpSplitter creates one chunk per method. The namespace and the class
+// declaration including its docblock are carried along as context, while the
+// part of the class before the first method (imports, properties, constants)
+// becomes a chunk of its own, as do the members between and after the
+// methods and the code after the last class.
+type phpSplitter struct{}
+
+func (phpSplitter) Split(content string) ([]Chunk, error) {
+	namespace := ""
+	if match := phpNamespaceRegexp.FindStringSubmatch(content); match != nil {
+		namespace = match[1]
+	}
+
+	var chunks []Chunk
+
+	// Files without a class, e.g. configuration returning arrays, are left to
+	// the text splitter
+	offset := 0
+
+	for {
+		loc := phpClassRegexp.FindStringSubmatchIndex(content[offset:])
+		if loc == nil {
+			break
+		}
+
+		classStart := leadingDocs(content, offset+loc[0])
+		kind := content[offset+loc[2] : offset+loc[3]]
+		className := content[offset+loc[4] : offset+loc[5]]
+		open := offset + loc[1] - 1
+		classEnd := matchingBrace(content, open, true)
+
+		fqcn := className
+		if namespace != "" {
+			fqcn = namespace + "\\" + className
+		}
+
+		var context strings.Builder
+		if namespace != "" {
+			context.WriteString("namespace " + namespace + ";\n\n")
+		}
+		context.WriteString(strings.TrimSpace(content[classStart:open]) + "\n{")
+
+		// The class header reaches from the end of the previous class (or the
+		// beginning of the file) to the first method
+		headerStart := offset
+		headerEnd := min(classEnd+1, len(content))
+		pos := open + 1
+
+		var members []Chunk
+
+		// Properties, constants, traits and comments between or after the
+		// methods become chunks of their own
+		appendMembers := func(start, end int) {
+			if chunk, ok := chunkAt(content, start, end, map[string]string{
+				"symbol": fqcn,
+				"kind":   "members",
+			}); ok {
+				chunk.Context = context.String()
+				members = append(members, chunk)
+			}
+		}
+
+		methodFound := false
+
+		for pos < classEnd {
+			fn := phpFunctionRegexp.FindStringSubmatchIndex(content[pos:classEnd])
+			if fn == nil {
+				break
+			}
+
+			methodStart := leadingDocs(content, pos+fn[0])
+			methodName := content[pos+fn[2] : pos+fn[3]]
+			methodEnd := phpFunctionEnd(content, pos+fn[1]-1, classEnd)
+
+			if !methodFound {
+				headerEnd = methodStart
+				methodFound = true
+			} else {
+				appendMembers(pos, methodStart)
+			}
+
+			if chunk, ok := chunkAt(content, methodStart, methodEnd, map[string]string{
+				"symbol": fqcn + "::" + methodName,
+				"kind":   "method",
+			}); ok {
+				chunk.Context = context.String()
+				members = append(members, chunk)
+			}
+
+			pos = methodEnd
+		}
+
+		if methodFound {
+			appendMembers(pos, min(classEnd, len(content)))
+		}
+
+		if chunk, ok := chunkAt(content, headerStart, headerEnd, map[string]string{
+			"symbol": fqcn,
+			"kind":   kind,
+		}); ok {
+			chunks = append(chunks, chunk)
+		}
+
+		chunks = append(chunks, members...)
+
+		offset = min(classEnd+1, len(content))
+	}
+
+	// Functions or statements after the last class would be lost otherwise
+	if offset > 0 {
+		if chunk, ok := chunkAt(content, offset, len(content), nil); ok {
+			if namespace != "" {
+				chunk.Context = "namespace " + namespace + ";\n"
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	return chunks, nil
+}
+
+// phpFunctionEnd returns the offset after the function whose parameter list
+// opens at paren. Abstract and interface methods end at the semicolon.
+func phpFunctionEnd(src string, paren, limit int) int {
+	depth := 0
+
+	for i := paren; i < limit; {
+		if next := skipLiteral(src, i, true); next != i {
+			i = next
+			continue
+		}
+
+		switch src[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ';':
+			if depth == 0 {
+				return i + 1
+			}
+		case '{':
+			if depth == 0 {
+				return min(matchingBrace(src, i, true)+1, limit)
+			}
+		}
+
+		i++
+	}
+
+	return limit
+}
@@ -0,0 +1,153 @@
+package indexer
+
+import (
+	"regexp"
+	"strings"
+)
+
+var scriptSymbolRegexps = []*regexp.Regexp{
+	regexp.MustCompile(`^(?:Shopware\.)?(?:Component|Mixin|Directive|Filter)\.(?:register|extend|override)\(\s*['"]([\w-]+)['"]`),
+	regexp.MustCompile(`^export\s+(?:default\s+)?(?:async\s+)?(?:abstract\s+)?(?:function\*?|class|const|let|var|interface|type|enum)\s+(\w+)`),
+	regexp.MustCompile(`^(?:async\s+)?(?:function\*?|class)\s+(\w+)`),
+	regexp.MustCompile(`^export\s+(default)\b`),
+}
+
+// scriptSplitter splits JavaScript, TypeScript and style sheets at top-level
+// statements. With symbols, every export, class, function and component
+// registration becomes a chunk of its own, while the remaining statements
+// (imports, constants, style rules) are grouped up to maxSize.
+type scriptSplitter struct {
+	maxSize int
+	symbols bool
+}
+
+type scriptStatement struct {
+	start  int
+	end    int
+	symbol string
+}
+
+func (s scriptSplitter) Split(content string) ([]Chunk, error) {
+	var chunks []Chunk
+
+	groupStart, groupEnd := -1, -1
+
+	flush := func() {
+		if groupStart == -1 {
+			return
+		}
+
+		if chunk, ok := chunkAt(content, groupStart, groupEnd, nil); ok {
+			chunks = append(chunks, chunk)
+		}
+
+		groupStart, groupEnd = -1, -1
+	}
+
+	for _, statement := range s.statements(content) {
+		if statement.symbol != "" {
+			flush()
+
+			if chunk, ok := chunkAt(content, statement.start, statement.end, map[string]string{
+				"symbol": statement.symbol,
+			}); ok {
+				chunks = append(chunks, chunk)
+			}
+
+			continue
+		}
+
+		if groupStart != -1 && statement.end-groupStart > s.maxSize {
+			flush()
+		}
+
+		if groupStart == -1 {
+			groupStart = statement.start
+		}
+		groupEnd = statement.end
+	}
+
+	flush()
+
+	return chunks, nil
+}
+
+// statements splits content at line breaks outside of any brackets. Comments
+// and blank lines are joined with the following statement.
+func (s scriptSplitter) statements(content string) []scriptStatement {
+	var statements []scriptStatement
+
+	depth := 0
+	start := 0
+
+	for i := 0; i < len(content); {
+		if next := skipLiteral(content, i, false); next != i {
+			i = next
+			continue
+		}
+
+		switch content[i] {
+		case '{', '(', '[':
+			depth++
+		case '}', ')', ']':
+			depth = max(depth-1, 0)
+		case '\n':
+			if depth == 0 {
+				text := strings.TrimSpace(content[start:i])
+
+				if text != "" && !isComment(text) {
+					statements = append(statements, scriptStatement{
+						start:  start,
+						end:    i,
+						symbol: s.symbol(text),
+					})
+					start = i + 1
+				}
+			}
+		}
+
+		i++
+	}
+
+	if strings.TrimSpace(content[start:]) != "" {
+		statements = append(statements, scriptStatement{
+			start:  start,
+			end:    len(content),
+			symbol: s.symbol(strings.TrimSpace(content[start:])),
+		})
+	}
+
+	return statements
+}
+
+func (s scriptSplitter) symbol(statement string) string {
+	if !s.symbols {
+		return ""
+	}
+
+	// Skip the comments joined with the statement
+	for strings.HasPrefix(statement, "//") || strings.HasPrefix(statement, "/*") {
+		statement = strings.TrimSpace(statement[skipLiteral(statement, 0, false):])
+	}
+
+	for _, re := range scriptSymbolRegexps {
+		if match := re.FindStringSubmatch(statement); match != nil {
+			return match[1]
+		}
+	}
+
+	return ""
+}
+
+// isComment reports whether text consists of comments only.
+func isComment(text string) bool {
+	for text != "" {
+		next := skipLiteral(text, 0, false)
+		if next == 0 || (text[0] != '/') {
+			return false
+		}
+		text = strings.TrimSpace(text[next:])
+	}
+
+	return true
+}
@@ -0,0 +1,129 @@
+package indexer
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	twigBlockRegexp   = regexp.MustCompile(`\{%-?\s*(block|endblock)\b\s*(\w*)([^%]*?)\s*-?%\}`)
+	twigExtendsRegexp = regexp.MustCompile(`\{%-?\s*(?:sw_extends|extends)\s[^%]*-?%\}`)
+)
+
+// twigSplitter creates one chunk per outermost {% block %}. Blocks exceeding
+// maxSize are replaced by their child blocks. The markup between the blocks
+// becomes a chunk of its own, so base templates are indexed completely. The
+// extends tag of the template is carried along as context.
+type twigSplitter struct {
+	maxSize int
+}
+
+type twigBlock struct {
+	name     string
+	start    int
+	end      int
+	children []*twigBlock
+}
+
+func (s twigSplitter) Split(content string) ([]Chunk, error) {
+	var roots []*twigBlock
+	var stack []*twigBlock
+
+	for _, loc := range twigBlockRegexp.FindAllStringSubmatchIndex(content, -1) {
+		tag := content[loc[2]:loc[3]]
+
+		if tag == "block" {
+			block := &twigBlock{
+				name:  content[loc[4]:loc[5]],
+				start: loc[0],
+				end:   loc[1],
+			}
+
+			// The short form {% block title 'value' %} has no end tag
+			shortForm := strings.TrimSpace(content[loc[6]:loc[7]]) != ""
+
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, block)
+			} else {
+				roots = append(roots, block)
+			}
+
+			if !shortForm {
+				stack = append(stack, block)
+			}
+
+			continue
+		}
+
+		if len(stack) == 0 {
+			continue
+		}
+
+		stack[len(stack)-1].end = loc[1]
+		stack = stack[:len(stack)-1]
+	}
+
+	context := twigExtendsRegexp.FindString(content)
+
+	var chunks []Chunk
+	s.appendBlocks(content, context, nil, roots, 0, len(content), &chunks)
+
+	return chunks, nil
+}
+
+// appendBlocks adds the chunks of the blocks and of the markup between them
+// within content[start:end].
+func (s twigSplitter) appendBlocks(content, context string, parents []string, blocks []*twigBlock, start, end int, chunks *[]Chunk) {
+	pos := start
+
+	for _, block := range blocks {
+		s.appendMarkup(content, context, parents, pos, lineStart(content, block.start), chunks)
+		pos = block.end
+
+		path := append(parents[:len(parents):len(parents)], block.name)
+
+		if block.end-block.start > s.maxSize && len(block.children) > 0 {
+			s.appendBlocks(content, context, path, block.children, lineStart(content, block.start), block.end, chunks)
+			continue
+		}
+
+		chunk, ok := chunkAt(content, lineStart(content, block.start), block.end, map[string]string{
+			"symbol": block.name,
+			"block":  strings.Join(path, " > "),
+		})
+		if !ok {
+			continue
+		}
+
+		chunk.Context = context
+		*chunks = append(*chunks, chunk)
+	}
+
+	s.appendMarkup(content, context, parents, pos, end, chunks)
+}
+
+// appendMarkup adds the markup outside of blocks as a chunk, it belongs to the
+// enclosing block if there is one.
+func (s twigSplitter) appendMarkup(content, context string, parents []string, start, end int, chunks *[]Chunk) {
+	var metadata map[string]string
+	if len(parents) > 0 {
+		metadata = map[string]string{
+			"symbol": parents[len(parents)-1],
+			"block":  strings.Join(parents, " > "),
+		}
+	}
+
+	// Blocks on the same line leave no markup in between
+	if start >= end {
+		return
+	}
+
+	chunk, ok := chunkAt(content, start, end, metadata)
+	if !ok || chunk.Content == context {
+		return
+	}
+
+	chunk.Context = context
+	*chunks = append(*chunks, chunk)
+}
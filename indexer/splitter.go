@@ -0,0 +1,192 @@
+package indexer
+
+import (
+	"path"
+	"strings"
+
+	"github.com/shopwarelabs/copilot-extension/config"
+	"github.com/tmc/langchaingo/textsplitter"
+)
+
+// SplitterVersion has to be increased whenever the splitting logic changes, so
+// that the next index run splits every file again.
+const SplitterVersion = 4
+
+// Chunk is a part of a file which is embedded as one document.
+type Chunk struct {
+	// Context is prepended to the content when embedding, e.g. the namespace
+	// and class declaration of a PHP method. It is not part of the line range.
+	Context string
+
+	// Content is the text of the chunk as it appears in the file
+	Content string
+
+	// StartLine and EndLine are the 1-based line range of Content in the file
+	StartLine int
+	EndLine   int
+
+	// Metadata describes the chunk, e.g. the symbol or block name
+	Metadata map[string]string
+}
+
+// Text returns the text which is stored and embedded for the chunk.
+func (c Chunk) Text() string {
+	if c.Context == "" {
+		return c.Content
+	}
+
+	return c.Context + "\n" + c.Content
+}
+
+// Splitter splits the content of a file into chunks.
+type Splitter interface {
+	Split(content string) ([]Chunk, error)
+}
+
+// SplitterFor returns the splitter matching the type of the given file. Chunks
+// exceeding the configured size are split further by characters.
+func SplitterFor(fileName string, chunking config.Chunking) Splitter {
+	text := newTextSplitter(chunking)
+
+	var splitter Splitter
+
+	switch strings.TrimPrefix(path.Ext(fileName), ".") {
+	case "php":
+		splitter = phpSplitter{}
+	case "twig":
+		splitter = twigSplitter{maxSize: chunking.Size}
+	case "js", "mjs", "ts":
+		splitter = scriptSplitter{maxSize: chunking.Size, symbols: true}
+	case "css", "scss":
+		splitter = scriptSplitter{maxSize: chunking.Size}
+	case "md":
+		splitter = markdownSplitter{fileName: fileName}
+	default:
+		return text
+	}
+
+	return limitSplitter{splitter: splitter, text: text, maxSize: chunking.Size}
+}
+
+// textSplitter splits at paragraphs, lines and words without knowledge of the
+// file type.
+type textSplitter struct {
+	split textsplitter.RecursiveCharacter
+}
+
+func newTextSplitter(chunking config.Chunking) textSplitter {
+	split := textsplitter.NewRecursiveCharacter()
+	split.ChunkSize = chunking.Size
+	split.ChunkOverlap = chunking.Overlap
+
+	return textSplitter{split: split}
+}
+
+func (s textSplitter) Split(content string) ([]Chunk, error) {
+	parts, err := s.split.SplitText(content)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := NewLineLocator(content)
+	chunks := make([]Chunk, 0, len(parts))
+
+	for _, part := range parts {
+		startLine, endLine := lines.Locate(part)
+
+		chunks = append(chunks, Chunk{
+			Content:   part,
+			StartLine: startLine,
+			EndLine:   endLine,
+		})
+	}
+
+	return chunks, nil
+}
+
+// limitSplitter splits chunks exceeding maxSize further by characters. A file
+// the language specific splitter produced no chunks for is split by
+// characters as a whole.
+type limitSplitter struct {
+	splitter Splitter
+	text     textSplitter
+	maxSize  int
+}
+
+func (s limitSplitter) Split(content string) ([]Chunk, error) {
+	chunks, err := s.splitter.Split(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(chunks) == 0 {
+		return s.text.Split(content)
+	}
+
+	limited := make([]Chunk, 0, len(chunks))
+
+	for _, chunk := range chunks {
+		if len(chunk.Text()) <= s.maxSize {
+			limited = append(limited, chunk)
+			continue
+		}
+
+		parts, err := s.text.Split(chunk.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, part := range parts {
+			part.Context = chunk.Context
+			part.Metadata = chunk.Metadata
+
+			if part.StartLine > 0 && chunk.StartLine > 0 {
+				part.StartLine += chunk.StartLine - 1
+				part.EndLine += chunk.StartLine - 1
+			} else {
+				part.StartLine, part.EndLine = chunk.StartLine, chunk.EndLine
+			}
+
+			limited = append(limited, part)
+		}
+	}
+
+	return limited, nil
+}
+
+// chunkAt returns the chunk spanning content[start:end] without surrounding
+// whitespace.
+func chunkAt(content string, start, end int, metadata map[string]string) (Chunk, bool) {
+	for start < end && isSpace(content[start]) {
+		start++
+	}
+
+	for end > start && isSpace(content[end-1]) {
+		end--
+	}
+
+	if start == end {
+		return Chunk{}, false
+	}
+
+	return Chunk{
+		Content:   content[start:end],
+		StartLine: lineAt(content, start),
+		EndLine:   lineAt(content, end-1),
+		Metadata:  metadata,
+	}, true
+}
+
+// lineAt returns the 1-based line of the byte at offset.
+func lineAt(content string, offset int) int {
+	return strings.Count(content[:offset], "\n") + 1
+}
+
+// lineStart returns the offset of the beginning of the line containing offset.
+func lineStart(content string, offset int) int {
+	return strings.LastIndexByte(content[:offset], '\n') + 1
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,296 @@
+package indexer
+
+import (
+	"reflect"
+	"testing"
+)
+
+// wantChunk is the part of a chunk the splitter tests compare.
+type wantChunk struct {
+	Content   string
+	StartLine int
+	EndLine   int
+	Metadata  map[string]string
+}
+
+func assertChunks(t *testing.T, chunks []Chunk, want []wantChunk) {
+	t.Helper()
+
+	var got []wantChunk
+	for _, chunk := range chunks {
+		got = append(got, wantChunk{
+			Content:   chunk.Content,
+			StartLine: chunk.StartLine,
+			EndLine:   chunk.EndLine,
+			Metadata:  chunk.Metadata,
+		})
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got chunks\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestPHPSplitter(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []wantChunk
+	}{
+		{
+			name:    "without class",
+			content: "<?php\n\nreturn ['a' => 1];\n",
+		},
+		{
+			name: "methods and members",
+			content: `<?php
+
+namespace Foo;
+
+use Bar\Baz;
+
+/**
+ * A class
+ */
+class Bar
+{
+    private int $a = 1;
+
+    public function a(): int
+    {
+        return $this->a;
+    }
+
+    use SomeTrait;
+
+    #[Required]
+    public function b(): void {}
+
+    public const B = 2;
+}
+
+function helper() {}
+`,
+			want: []wantChunk{
+				{Content: "<?php\n\nnamespace Foo;\n\nuse Bar\\Baz;\n\n/**\n * A class\n */\nclass Bar\n{\n    private int $a = 1;", StartLine: 1, EndLine: 12, Metadata: map[string]string{"symbol": `Foo\Bar`, "kind": "class"}},
+				{Content: "public function a(): int\n    {\n        return $this->a;\n    }", StartLine: 14, EndLine: 17, Metadata: map[string]string{"symbol": `Foo\Bar::a`, "kind": "method"}},
+				{Content: "use SomeTrait;", StartLine: 19, EndLine: 19, Metadata: map[string]string{"symbol": `Foo\Bar`, "kind": "members"}},
+				{Content: "#[Required]\n    public function b(): void {}", StartLine: 21, EndLine: 22, Metadata: map[string]string{"symbol": `Foo\Bar::b`, "kind": "method"}},
+				{Content: "public const B = 2;", StartLine: 24, EndLine: 24, Metadata: map[string]string{"symbol": `Foo\Bar`, "kind": "members"}},
+				{Content: "function helper() {}", StartLine: 27, EndLine: 27},
+			},
+		},
+		{
+			name:    "interface",
+			content: "<?php\ninterface Foo\n{\n    public function a(): void;\n}\n",
+			want: []wantChunk{
+				{Content: "<?php\ninterface Foo\n{", StartLine: 1, EndLine: 3, Metadata: map[string]string{"symbol": "Foo", "kind": "interface"}},
+				{Content: "public function a(): void;", StartLine: 4, EndLine: 4, Metadata: map[string]string{"symbol": "Foo::a", "kind": "method"}},
+			},
+		},
+		{
+			name:    "two classes",
+			content: "<?php\nclass A\n{\n}\n\nfinal class B\n{\n    public function b() {}\n}\n",
+			want: []wantChunk{
+				{Content: "<?php\nclass A\n{\n}", StartLine: 1, EndLine: 4, Metadata: map[string]string{"symbol": "A", "kind": "class"}},
+				{Content: "final class B\n{", StartLine: 6, EndLine: 7, Metadata: map[string]string{"symbol": "B", "kind": "class"}},
+				{Content: "public function b() {}", StartLine: 8, EndLine: 8, Metadata: map[string]string{"symbol": "B::b", "kind": "method"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := phpSplitter{}.Split(tt.content)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			assertChunks(t, chunks, tt.want)
+		})
+	}
+}
+
+func TestPHPSplitterContext(t *testing.T) {
+	chunks, err := phpSplitter{}.Split("<?php\nnamespace Foo;\n\nabstract class Bar extends Baz\n{\n    public function a() {}\n}\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(chunks) != 2 {
+		t.Fatalf("got %d chunks, want 2", len(chunks))
+	}
+
+	if want := "namespace Foo;\n\nabstract class Bar extends Baz\n{"; chunks[1].Context != want {
+		t.Errorf("got context %q, want %q", chunks[1].Context, want)
+	}
+}
+
+func TestTwigSplitter(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int
+		content string
+		want    []wantChunk
+	}{
+		{
+			name:    "blocks and markup",
+			maxSize: 1000,
+			content: "{% sw_extends '@Storefront/base.html.twig' %}\n\n{% block a %}\n    A\n{% endblock %}\n\n<p>between</p>\n\n{% block b 'short' %}\n",
+			want: []wantChunk{
+				{Content: "{% block a %}\n    A\n{% endblock %}", StartLine: 3, EndLine: 5, Metadata: map[string]string{"symbol": "a", "block": "a"}},
+				{Content: "<p>between</p>", StartLine: 7, EndLine: 7},
+				{Content: "{% block b 'short' %}", StartLine: 9, EndLine: 9, Metadata: map[string]string{"symbol": "b", "block": "b"}},
+			},
+		},
+		{
+			name:    "base template",
+			maxSize: 1000,
+			content: "<html>\n<body>\n{% block content %}{% endblock %}\n</body>\n</html>\n",
+			want: []wantChunk{
+				{Content: "<html>\n<body>", StartLine: 1, EndLine: 2},
+				{Content: "{% block content %}{% endblock %}", StartLine: 3, EndLine: 3, Metadata: map[string]string{"symbol": "content", "block": "content"}},
+				{Content: "</body>\n</html>", StartLine: 4, EndLine: 5},
+			},
+		},
+		{
+			name:    "large block is split into children",
+			maxSize: 40,
+			content: "{% block outer %}\n<div>\n{%- block inner -%}\ninner\n{%- endblock -%}\n</div>\n{% endblock %}\n",
+			want: []wantChunk{
+				{Content: "{% block outer %}\n<div>", StartLine: 1, EndLine: 2, Metadata: map[string]string{"symbol": "outer", "block": "outer"}},
+				{Content: "{%- block inner -%}\ninner\n{%- endblock -%}", StartLine: 3, EndLine: 5, Metadata: map[string]string{"symbol": "inner", "block": "outer > inner"}},
+				{Content: "</div>\n{% endblock %}", StartLine: 6, EndLine: 7, Metadata: map[string]string{"symbol": "outer", "block": "outer"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := twigSplitter{maxSize: tt.maxSize}.Split(tt.content)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			assertChunks(t, chunks, tt.want)
+		})
+	}
+}
+
+func TestScriptSplitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		splitter scriptSplitter
+		content  string
+		want     []wantChunk
+	}{
+		{
+			name:     "symbols",
+			splitter: scriptSplitter{maxSize: 1000, symbols: true},
+			content: `import a from 'a';
+import b from 'b';
+
+// Registers the component
+Shopware.Component.register('sw-foo', {
+    template: '{ not a brace }',
+});
+
+export function bar() {
+    return 1;
+}
+
+const c = 1;
+`,
+			want: []wantChunk{
+				{Content: "import a from 'a';\nimport b from 'b';", StartLine: 1, EndLine: 2},
+				{Content: "// Registers the component\nShopware.Component.register('sw-foo', {\n    template: '{ not a brace }',\n});", StartLine: 4, EndLine: 7, Metadata: map[string]string{"symbol": "sw-foo"}},
+				{Content: "export function bar() {\n    return 1;\n}", StartLine: 9, EndLine: 11, Metadata: map[string]string{"symbol": "bar"}},
+				{Content: "const c = 1;", StartLine: 13, EndLine: 13},
+			},
+		},
+		{
+			name:     "styles are grouped up to the size",
+			splitter: scriptSplitter{maxSize: 30},
+			content:  ".a {\n    color: red;\n}\n.b {\n    color: blue;\n}\n",
+			want: []wantChunk{
+				{Content: ".a {\n    color: red;\n}", StartLine: 1, EndLine: 3},
+				{Content: ".b {\n    color: blue;\n}", StartLine: 4, EndLine: 6},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := tt.splitter.Split(tt.content)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			assertChunks(t, chunks, tt.want)
+		})
+	}
+}
+
+func TestMarkdownSplitter(t *testing.T) {
+	content := `---
+title: Plugin base guide
+nav:
+  position: 10
+tags: [plugin, guide]
+---
+
+# Plugin base guide
+
+Intro
+
+## Installation
+
+## Requirements
+
+` + "```bash\n# not a heading\n```" + `
+
+## Usage
+
+Text
+`
+
+	chunks, err := markdownSplitter{fileName: "guides/plugins/plugin-base-guide.md"}.Split(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	base := map[string]string{"title": "Plugin base guide", "nav_position": "10", "tags": "plugin,guide"}
+	withHeading := func(heading, breadcrumb string) map[string]string {
+		metadata := map[string]string{"heading": heading, "breadcrumb": breadcrumb}
+		for key, value := range base {
+			metadata[key] = value
+		}
+		return metadata
+	}
+
+	assertChunks(t, chunks, []wantChunk{
+		{Content: "# Plugin base guide\n\nIntro", StartLine: 8, EndLine: 10, Metadata: withHeading("Plugin base guide", "Guides > Plugins > Plugin base guide")},
+		{Content: "## Installation\n\n## Requirements\n\n```bash\n# not a heading\n```", StartLine: 12, EndLine: 18, Metadata: withHeading("Requirements", "Guides > Plugins > Plugin base guide > Requirements")},
+		{Content: "## Usage\n\nText", StartLine: 20, EndLine: 22, Metadata: withHeading("Usage", "Guides > Plugins > Plugin base guide > Usage")},
+	})
+
+	if want := "Guides > Plugins > Plugin base guide > Usage"; chunks[2].Context != want {
+		t.Errorf("got context %q, want %q", chunks[2].Context, want)
+	}
+}
+
+func TestHumanize(t *testing.T) {
+	tests := map[string]string{
+		"plugin-base-guide": "Plugin Base Guide",
+		"add_custom_field":  "Add Custom Field",
+		"über-uns":          "Über Uns",
+		"ärger":             "Ärger",
+		"":                  "",
+	}
+
+	for name, want := range tests {
+		if got := humanize(name); got != want {
+			t.Errorf("humanize(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
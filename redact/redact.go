@@ -0,0 +1,58 @@
+// Package redact removes credentials from text before it is logged.
+package redact
+
+import (
+	"io"
+	"regexp"
+)
+
+const redacted = "[REDACTED]"
+
+var patterns = []struct {
+	regexp      *regexp.Regexp
+	replacement []byte
+}{
+	// GitHub tokens, e.g. ghu_... or github_pat_...
+	{regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{16,}|github_pat_[A-Za-z0-9_]{16,})`), []byte(redacted)},
+
+	// Copilot API tokens
+	{regexp.MustCompile(`\btid=[^\s"',]+`), []byte(redacted)},
+
+	// Authorization header values
+	{regexp.MustCompile(`(?i)\b(bearer)(\s+)[A-Za-z0-9._~+/=-]{8,}`), []byte("${1}${2}" + redacted)},
+}
+
+// String replaces the credentials in s.
+func String(s string) string {
+	return string(Bytes([]byte(s)))
+}
+
+// Bytes replaces the credentials in b.
+func Bytes(b []byte) []byte {
+	for _, pattern := range patterns {
+		b = pattern.regexp.ReplaceAll(b, pattern.replacement)
+	}
+
+	return b
+}
+
+type writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a writer which redacts credentials before writing to w.
+// Every write is redacted on its own, so credentials split across writes are
+// not detected. Loggers write whole lines at once.
+func NewWriter(w io.Writer) io.Writer {
+	return writer{
+		w: w,
+	}
+}
+
+func (w writer) Write(p []byte) (int, error) {
+	if _, err := w.w.Write(Bytes(p)); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
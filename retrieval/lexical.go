@@ -0,0 +1,320 @@
+package retrieval
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// LexicalIndex is a BM25 ranked inverted index over the documents of the
+// collection. It finds exact identifiers like ProductPageLoadedEvent or
+// sw-product-detail, which embeddings tend to miss.
+type LexicalIndex struct {
+	path string
+
+	mu          sync.RWMutex
+	docs        map[string]*lexicalDocument
+	postings    map[string]map[string]int
+	totalLength int
+}
+
+type lexicalDocument struct {
+	Length   int
+	Terms    map[string]int
+	Metadata map[string]string
+}
+
+// LexicalResult is a document matching a lexical query.
+type LexicalResult struct {
+	ID    string
+	Score float64
+}
+
+// LoadLexicalIndex reads the index persisted at path. A missing file results
+// in an empty index.
+func LoadLexicalIndex(path string) (*LexicalIndex, error) {
+	l := &LexicalIndex{
+		path:     path,
+		docs:     make(map[string]*lexicalDocument),
+		postings: make(map[string]map[string]int),
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return l, nil
+		}
+
+		return nil, fmt.Errorf("failed to open lexical index: %w", err)
+	}
+	defer file.Close()
+
+	if err := gob.NewDecoder(file).Decode(&l.docs); err != nil {
+		return nil, fmt.Errorf("failed to decode lexical index: %w", err)
+	}
+
+	for id, doc := range l.docs {
+		l.totalLength += doc.Length
+		for term, count := range doc.Terms {
+			l.post(term, id, count)
+		}
+	}
+
+	return l, nil
+}
+
+// Save persists the index. The file is replaced atomically.
+func (l *LexicalIndex) Save() error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create lexical index directory: %w", err)
+	}
+
+	tmp := l.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create lexical index: %w", err)
+	}
+
+	l.mu.RLock()
+	err = gob.NewEncoder(file).Encode(l.docs)
+	l.mu.RUnlock()
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to write lexical index: %w", err)
+	}
+
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("failed to replace lexical index: %w", err)
+	}
+
+	return nil
+}
+
+// Add indexes the document, replacing a previous version with the same ID.
+func (l *LexicalIndex) Add(id, content string, metadata map[string]string) {
+	terms := make(map[string]int)
+	length := 0
+
+	for _, term := range Tokenize(content) {
+		terms[term]++
+		length++
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.remove(id)
+
+	l.docs[id] = &lexicalDocument{
+		Length:   length,
+		Terms:    terms,
+		Metadata: metadata,
+	}
+	l.totalLength += length
+
+	for term, count := range terms {
+		l.post(term, id, count)
+	}
+}
+
+// Remove deletes the documents with the given IDs.
+func (l *LexicalIndex) Remove(ids ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, id := range ids {
+		l.remove(id)
+	}
+}
+
+// Has reports whether the document with the given ID is indexed.
+func (l *LexicalIndex) Has(id string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	_, ok := l.docs[id]
+	return ok
+}
+
+// Len returns the number of indexed documents.
+func (l *LexicalIndex) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return len(l.docs)
+}
+
+// Search returns up to limit documents ranked by BM25. Like chromem, where
+// filters the documents by exact metadata values.
+func (l *LexicalIndex) Search(query string, limit int, where map[string]string) []LexicalResult {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if len(l.docs) == 0 || limit <= 0 {
+		return nil
+	}
+
+	avgLength := float64(l.totalLength) / float64(len(l.docs))
+	scores := make(map[string]float64)
+
+	seen := make(map[string]struct{})
+	for _, term := range Tokenize(query) {
+		if _, ok := seen[term]; ok {
+			continue
+		}
+		seen[term] = struct{}{}
+
+		postings := l.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+
+		n := float64(len(postings))
+		idf := math.Log(1 + (float64(len(l.docs))-n+0.5)/(n+0.5))
+
+		for id, count := range postings {
+			doc := l.docs[id]
+			if !matchesWhere(doc.Metadata, where) {
+				continue
+			}
+
+			tf := float64(count)
+			scores[id] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(doc.Length)/avgLength))
+		}
+	}
+
+	results := make([]LexicalResult, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, LexicalResult{ID: id, Score: score})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].ID < results[j].ID
+		}
+		return results[i].Score > results[j].Score
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+func (l *LexicalIndex) post(term, id string, count int) {
+	postings, ok := l.postings[term]
+	if !ok {
+		postings = make(map[string]int)
+		l.postings[term] = postings
+	}
+
+	postings[id] = count
+}
+
+func (l *LexicalIndex) remove(id string) {
+	doc, ok := l.docs[id]
+	if !ok {
+		return
+	}
+
+	for term := range doc.Terms {
+		delete(l.postings[term], id)
+		if len(l.postings[term]) == 0 {
+			delete(l.postings, term)
+		}
+	}
+
+	l.totalLength -= doc.Length
+	delete(l.docs, id)
+}
+
+func matchesWhere(metadata, where map[string]string) bool {
+	for key, value := range where {
+		if metadata[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Tokenize splits text into lower-cased terms. Identifiers are indexed as a
+// whole and by their parts, so "ProductPageLoadedEvent" yields
+// "productpageloadedevent", "product", "page", "loaded" and "event", and
+// "sw-product-detail" yields "sw-product-detail", "sw", "product" and
+// "detail".
+func Tokenize(text string) []string {
+	var terms []string
+
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && r != '.' && r != '\\'
+	})
+
+	for _, word := range words {
+		word = strings.Trim(word, "-._\\")
+		if word == "" {
+			continue
+		}
+
+		parts := strings.FieldsFunc(word, func(r rune) bool {
+			return r == '-' || r == '.' || r == '_' || r == '\\'
+		})
+
+		var subwords []string
+		for _, part := range parts {
+			subwords = append(subwords, splitCamelCase(part)...)
+		}
+
+		terms = append(terms, strings.ToLower(word))
+
+		if len(subwords) > 1 {
+			for _, subword := range subwords {
+				terms = append(terms, strings.ToLower(subword))
+			}
+		}
+	}
+
+	return terms
+}
+
+// splitCamelCase splits "ProductPageLoadedEvent" into its words. Runs of upper
+// case letters like "HTTPClient" are kept together as "HTTP" and "Client".
+func splitCamelCase(word string) []string {
+	runes := []rune(word)
+
+	var words []string
+	start := 0
+
+	for i := 1; i < len(runes); i++ {
+		prev, cur := runes[i-1], runes[i]
+
+		lowerToUpper := unicode.IsLower(prev) && unicode.IsUpper(cur)
+		acronymEnd := unicode.IsUpper(prev) && unicode.IsUpper(cur) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		letterToDigit := unicode.IsLetter(prev) != unicode.IsLetter(cur)
+
+		if lowerToUpper || acronymEnd || letterToDigit {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+
+	return append(words, string(runes[start:]))
+}
@@ -0,0 +1,208 @@
+package retrieval
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"ProductPageLoadedEvent", []string{"productpageloadedevent", "product", "page", "loaded", "event"}},
+		{"sw-product-detail", []string{"sw-product-detail", "sw", "product", "detail"}},
+		{"HTTPClient", []string{"httpclient", "http", "client"}},
+		{`Shopware\Core\Framework`, []string{`shopware\core\framework`, "shopware", "core", "framework"}},
+		{"snake_case_name", []string{"snake_case_name", "snake", "case", "name"}},
+		{"v6.5.8.0", []string{"v6.5.8.0", "v", "6", "5", "8", "0"}},
+		{"Hello, world!", []string{"hello", "world"}},
+		{"--flag.", []string{"flag"}},
+		{"Über Straße", []string{"über", "straße"}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %#v, want %#v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func newTestLexicalIndex(t *testing.T, docs map[string]string) *LexicalIndex {
+	t.Helper()
+
+	index, err := LoadLexicalIndex(filepath.Join(t.TempDir(), "lexical.gob"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for id, content := range docs {
+		index.Add(id, content, map[string]string{"source": id[:1]})
+	}
+
+	return index
+}
+
+func resultIDs(results []LexicalResult) []string {
+	var ids []string
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	return ids
+}
+
+func TestLexicalIndexSearch(t *testing.T) {
+	tests := []struct {
+		name  string
+		docs  map[string]string
+		query string
+		limit int
+		where map[string]string
+		want  []string
+	}{
+		{
+			name: "term frequency",
+			docs: map[string]string{
+				"a1": "product page loaded",
+				"a2": "product product product detail",
+				"a3": "category",
+			},
+			query: "product",
+			limit: 10,
+			want:  []string{"a2", "a1"},
+		},
+		{
+			name: "exact identifier ranks first",
+			docs: map[string]string{
+				"a1": "the product page",
+				"a2": "ProductPageLoadedEvent is dispatched",
+			},
+			query: "ProductPageLoadedEvent",
+			limit: 10,
+			want:  []string{"a2", "a1"},
+		},
+		{
+			name: "rare terms weigh more",
+			docs: map[string]string{
+				"a1": "shopware plugin",
+				"a2": "shopware plugin",
+				"a3": "shopware theme",
+			},
+			query: "shopware theme",
+			limit: 10,
+			want:  []string{"a3", "a1", "a2"},
+		},
+		{
+			name: "shorter documents weigh more",
+			docs: map[string]string{
+				"a1": "cache invalidation of the http cache layer in detail",
+				"a2": "cache",
+			},
+			query: "cache",
+			limit: 10,
+			want:  []string{"a2", "a1"},
+		},
+		{
+			name: "limit",
+			docs: map[string]string{
+				"a1": "product",
+				"a2": "product product",
+				"a3": "product product product",
+			},
+			query: "product",
+			limit: 2,
+			want:  []string{"a3", "a2"},
+		},
+		{
+			name: "where",
+			docs: map[string]string{
+				"a1": "product",
+				"b1": "product product",
+			},
+			query: "product",
+			limit: 10,
+			where: map[string]string{"source": "a"},
+			want:  []string{"a1"},
+		},
+		{
+			name:  "no match",
+			docs:  map[string]string{"a1": "product"},
+			query: "category",
+			limit: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := newTestLexicalIndex(t, tt.docs)
+
+			if got := resultIDs(index.Search(tt.query, tt.limit, tt.where)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLexicalIndexAddReplacesAndRemoves(t *testing.T) {
+	index := newTestLexicalIndex(t, map[string]string{"a1": "product"})
+
+	index.Add("a1", "category", nil)
+
+	if got := index.Search("product", 10, nil); len(got) != 0 {
+		t.Errorf("replaced document still matches: %v", got)
+	}
+
+	index.Remove("a1")
+
+	if index.Has("a1") || index.Len() != 0 {
+		t.Errorf("removed document is still indexed")
+	}
+
+	if got := index.Search("category", 10, nil); len(got) != 0 {
+		t.Errorf("removed document still matches: %v", got)
+	}
+}
+
+func TestLexicalIndexSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db", "lexical.gob")
+
+	index, err := LoadLexicalIndex(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if index.Len() != 0 {
+		t.Fatalf("missing file should result in an empty index")
+	}
+
+	index.Add("a1", "ProductPageLoadedEvent is dispatched", map[string]string{"source": "src"})
+	index.Add("a2", "the product page", map[string]string{"source": "docs"})
+	index.Add("a3", "removed", nil)
+	index.Remove("a3")
+
+	if err := index.Save(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded, err := LoadLexicalIndex(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if loaded.Len() != 2 || !loaded.Has("a1") || !loaded.Has("a2") || loaded.Has("a3") {
+		t.Fatalf("got %d documents after loading, want a1 and a2", loaded.Len())
+	}
+
+	for _, query := range []string{"product page", "ProductPageLoadedEvent", "dispatched"} {
+		want := index.Search(query, 10, nil)
+		if got := loaded.Search(query, 10, nil); !reflect.DeepEqual(got, want) {
+			t.Errorf("search for %q got %v after loading, want %v", query, got, want)
+		}
+	}
+
+	if got := resultIDs(loaded.Search("product", 10, map[string]string{"source": "docs"})); !reflect.DeepEqual(got, []string{"a2"}) {
+		t.Errorf("metadata was not restored, got %v", got)
+	}
+}
@@ -0,0 +1,124 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// rrfK dampens the influence of the top ranks in reciprocal rank fusion. 60 is
+// the value proposed in the original paper.
+const rrfK = 60
+
+// candidateFactor controls how many candidates are fetched from each index
+// per requested result before fusing them.
+const candidateFactor = 4
+
+// Retriever finds documents by fusing the ranks of the vector search and the
+// lexical index with reciprocal rank fusion.
+type Retriever struct {
+	collection *chromem.Collection
+	lexical    *LexicalIndex
+}
+
+// Result is a document returned by the retriever.
+type Result struct {
+	ID       string
+	Content  string
+	Metadata map[string]string
+
+	// Similarity is the cosine similarity of the vector search, zero for
+	// documents only found by the lexical index
+	Similarity float32
+
+	// Score is the fused reciprocal rank score
+	Score float64
+}
+
+// New creates a retriever. Without a lexical index it only performs vector
+// search.
+func New(collection *chromem.Collection, lexical *LexicalIndex) *Retriever {
+	return &Retriever{
+		collection: collection,
+		lexical:    lexical,
+	}
+}
+
+// Collection returns the underlying vector collection.
+func (r *Retriever) Collection() *chromem.Collection {
+	return r.collection
+}
+
+// Query returns up to limit documents matching query. where filters the
+// documents by exact metadata values.
+func (r *Retriever) Query(ctx context.Context, query string, limit int, where map[string]string) ([]Result, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be greater than zero")
+	}
+
+	candidates := min(limit*candidateFactor, r.collection.Count())
+	if candidates == 0 {
+		return nil, nil
+	}
+
+	vectorResults, err := r.collection.Query(ctx, query, candidates, where, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query collection: %w", err)
+	}
+
+	results := make(map[string]*Result, len(vectorResults))
+
+	for rank, doc := range vectorResults {
+		results[doc.ID] = &Result{
+			ID:         doc.ID,
+			Content:    doc.Content,
+			Metadata:   doc.Metadata,
+			Similarity: doc.Similarity,
+			Score:      1 / float64(rrfK+rank+1),
+		}
+	}
+
+	if r.lexical != nil {
+		for rank, hit := range r.lexical.Search(query, candidates, where) {
+			score := 1 / float64(rrfK+rank+1)
+
+			if result, ok := results[hit.ID]; ok {
+				result.Score += score
+				continue
+			}
+
+			doc, err := r.collection.GetByID(ctx, hit.ID)
+			if err != nil {
+				// The lexical index is ahead of or behind the collection, skip it
+				continue
+			}
+
+			results[hit.ID] = &Result{
+				ID:       doc.ID,
+				Content:  doc.Content,
+				Metadata: doc.Metadata,
+				Score:    score,
+			}
+		}
+	}
+
+	fused := make([]Result, 0, len(results))
+	for _, result := range results {
+		fused = append(fused, *result)
+	}
+
+	sort.Slice(fused, func(i, j int) bool {
+		if fused[i].Score == fused[j].Score {
+			return fused[i].Similarity > fused[j].Similarity
+		}
+		return fused[i].Score > fused[j].Score
+	})
+
+	if len(fused) > limit {
+		fused = fused[:limit]
+	}
+
+	return fused, nil
+}
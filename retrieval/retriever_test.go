@@ -0,0 +1,177 @@
+package retrieval
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// testDocument has a fixed cosine similarity to every query, so the rank of
+// the vector search is known.
+type testDocument struct {
+	id         string
+	content    string
+	similarity float32
+}
+
+func newTestRetriever(t *testing.T, docs []testDocument) (*Retriever, *LexicalIndex) {
+	t.Helper()
+
+	dimensions := len(docs) + 1
+
+	// Queries point along the first dimension, every document gets a
+	// dimension of its own for the remainder of its unit vector
+	embed := func(ctx context.Context, text string) ([]float32, error) {
+		vector := make([]float32, dimensions)
+		vector[0] = 1
+		return vector, nil
+	}
+
+	collection, err := chromem.NewDB().CreateCollection("test", nil, embed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lexical, err := LoadLexicalIndex(filepath.Join(t.TempDir(), "lexical.gob"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, doc := range docs {
+		embedding := make([]float32, dimensions)
+		embedding[0] = doc.similarity
+		embedding[i+1] = float32(math.Sqrt(float64(1 - doc.similarity*doc.similarity)))
+
+		if err := collection.AddDocument(context.Background(), chromem.Document{
+			ID:        doc.id,
+			Content:   doc.content,
+			Embedding: embedding,
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		lexical.Add(doc.id, doc.content, nil)
+	}
+
+	return New(collection, lexical), lexical
+}
+
+func TestRetrieverQueryFusesRanks(t *testing.T) {
+	docs := []testDocument{
+		{"v1", "unrelated text", 0.9},
+		{"v2", "alpha appears in a longer text with more words", 0.8},
+		{"v3", "alpha alpha", 0.7},
+		{"v4", "nothing here", 0.6},
+		{"f1", "filler one", 0.5},
+		{"f2", "filler two", 0.45},
+		{"f3", "filler three", 0.4},
+		{"f4", "filler four", 0.35},
+		{"f5", "filler five", 0.3},
+		{"x", "alpha", 0.1},
+	}
+
+	retriever, lexical := newTestRetriever(t, docs)
+
+	for _, limit := range []int{2, 10} {
+		// The vector search returns limit*candidateFactor candidates, ranked
+		// by similarity like the documents above
+		candidates := min(limit*candidateFactor, len(docs))
+
+		want := make(map[string]float64)
+		similarity := make(map[string]float32)
+		for rank, doc := range docs[:candidates] {
+			want[doc.id] = 1 / float64(60+rank+1)
+			similarity[doc.id] = doc.similarity
+		}
+		for rank, hit := range lexical.Search("alpha", candidates, nil) {
+			want[hit.ID] += 1 / float64(60+rank+1)
+		}
+
+		// With two results, x is no vector candidate and only found by the
+		// lexical index
+		if _, ok := want["x"]; !ok {
+			t.Fatalf("limit %d: x is not a lexical hit", limit)
+		}
+
+		results, err := retriever.Query(context.Background(), "alpha", limit, nil)
+		if err != nil {
+			t.Fatalf("limit %d: unexpected error: %v", limit, err)
+		}
+
+		ids := make([]string, 0, len(want))
+		for id := range want {
+			ids = append(ids, id)
+		}
+		// Equal scores are ranked by similarity like the retriever does, lexical
+		// only hits have none
+		sort.Slice(ids, func(i, j int) bool {
+			if want[ids[i]] == want[ids[j]] {
+				return similarity[ids[i]] > similarity[ids[j]]
+			}
+			return want[ids[i]] > want[ids[j]]
+		})
+		ids = ids[:min(limit, len(ids))]
+
+		if len(results) != len(ids) {
+			t.Fatalf("limit %d: got %d results, want %d", limit, len(results), len(ids))
+		}
+
+		for i, result := range results {
+			if result.ID != ids[i] {
+				t.Errorf("limit %d: result %d is %s, want %s", limit, i, result.ID, ids[i])
+			}
+
+			if math.Abs(result.Score-want[result.ID]) > 1e-12 {
+				t.Errorf("limit %d: %s has score %v, want %v", limit, result.ID, result.Score, want[result.ID])
+			}
+		}
+	}
+}
+
+func TestRetrieverQueryLexicalOnlyHit(t *testing.T) {
+	docs := []testDocument{
+		{"v1", "first", 0.9},
+		{"v2", "second", 0.8},
+		{"v3", "third", 0.7},
+		{"v4", "fourth", 0.6},
+		{"v5", "fifth", 0.5},
+		{"v6", "sixth", 0.4},
+		{"v7", "seventh", 0.3},
+		{"v8", "eighth", 0.2},
+		{"x", "ProductPageLoadedEvent is dispatched", 0.1},
+	}
+
+	retriever, _ := newTestRetriever(t, docs)
+
+	// Two results yield eight vector candidates, x is only found by the
+	// lexical index and loaded from the collection
+	results, err := retriever.Query(context.Background(), "ProductPageLoadedEvent", 2, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(results) != 2 || results[0].ID != "v1" || results[1].ID != "x" {
+		t.Fatalf("got %v, want v1 and x ranked by similarity on equal scores", results)
+	}
+
+	x := results[1]
+	if want := 1 / float64(61); math.Abs(x.Score-want) > 1e-12 {
+		t.Errorf("x has score %v, want %v", x.Score, want)
+	}
+
+	if x.Similarity != 0 || x.Content != "ProductPageLoadedEvent is dispatched" {
+		t.Errorf("got %#v, want the document loaded from the collection without similarity", x)
+	}
+}
+
+func TestRetrieverQueryInvalidLimit(t *testing.T) {
+	retriever, _ := newTestRetriever(t, []testDocument{{"a", "a", 0.5}})
+
+	if _, err := retriever.Query(context.Background(), "a", 0, nil); err == nil {
+		t.Error("expected an error for a zero limit")
+	}
+}
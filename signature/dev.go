@@ -0,0 +1,84 @@
+package signature
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DevKeyID identifies the key of the development mode.
+const DevKeyID = "dev"
+
+// LoadOrCreateDevKey reads the private key of the development mode from path.
+// A new key is generated and stored when the file doesn't exist.
+func LoadOrCreateDevKey(path string) (*ecdsa.PrivateKey, error) {
+	content, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(content)
+		if block == nil {
+			return nil, fmt.Errorf("error parsing PEM block of %s", path)
+		}
+
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key %s: %w", path, err)
+		}
+
+		return key, nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %w", err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create directory of %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write private key: %w", err)
+	}
+
+	return key, nil
+}
+
+// DevKeys provides the public part of the development key.
+func DevKeys(key *ecdsa.PrivateKey) KeySource {
+	return StaticKeys(Key{
+		ID:        DevKeyID,
+		PublicKey: &key.PublicKey,
+		Current:   true,
+	})
+}
+
+// Sign returns the signature of payload in the format of the
+// Github-Public-Key-Signature header.
+func Sign(payload []byte, key *ecdsa.PrivateKey) (string, error) {
+	digest := sha256.Sum256(payload)
+
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign payload: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
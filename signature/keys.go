@@ -0,0 +1,162 @@
+package signature
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// GitHubKeysURL lists the keys GitHub signs Copilot agent requests with.
+const GitHubKeysURL = "https://api.github.com/meta/public_keys/copilot_api"
+
+// Key is a public key requests are signed with.
+type Key struct {
+	// ID is sent in the Github-Public-Key-Identifier header of requests
+	// signed with this key
+	ID        string
+	PublicKey *ecdsa.PublicKey
+
+	// Current marks the key GitHub signs new requests with
+	Current bool
+}
+
+// KeySource provides the published keys.
+type KeySource interface {
+	Keys(ctx context.Context) ([]Key, error)
+}
+
+type gitHubKeys struct {
+	client *http.Client
+	url    string
+}
+
+// GitHubKeys fetches the keys from the GitHub API.
+func GitHubKeys(client *http.Client) KeySource {
+	return gitHubKeys{
+		client: client,
+		url:    GitHubKeysURL,
+	}
+}
+
+func (s gitHubKeys) Keys(ctx context.Context) ([]Key, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch public keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch public keys: %s", resp.Status)
+	}
+
+	var respBody keysResponse
+	if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+		return nil, fmt.Errorf("failed to decode public keys: %w", err)
+	}
+
+	return respBody.parse()
+}
+
+type fileKeys struct {
+	path string
+}
+
+// FileKeys reads the keys from a file in the format of the GitHub API, for
+// setups without access to GitHub. The file is read again when a request is
+// signed with an unknown key.
+func FileKeys(path string) KeySource {
+	return fileKeys{
+		path: path,
+	}
+}
+
+func (s fileKeys) Keys(ctx context.Context) ([]Key, error) {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public keys: %w", err)
+	}
+
+	var keys keysResponse
+	if err := json.Unmarshal(content, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode public keys of %s: %w", s.path, err)
+	}
+
+	return keys.parse()
+}
+
+type staticKeys []Key
+
+// StaticKeys provides a fixed set of keys.
+func StaticKeys(keys ...Key) KeySource {
+	return staticKeys(keys)
+}
+
+func (s staticKeys) Keys(ctx context.Context) ([]Key, error) {
+	return s, nil
+}
+
+// keysResponse is the response of the GitHub API.
+type keysResponse struct {
+	PublicKeys []struct {
+		KeyIdentifier string `json:"key_identifier"`
+		Key           string `json:"key"`
+		IsCurrent     bool   `json:"is_current"`
+	} `json:"public_keys"`
+}
+
+func (r keysResponse) parse() ([]Key, error) {
+	keys := make([]Key, 0, len(r.PublicKeys))
+
+	for _, pk := range r.PublicKeys {
+		publicKey, err := ParsePublicKey(pk.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key %s: %w", pk.KeyIdentifier, err)
+		}
+
+		keys = append(keys, Key{
+			ID:        pk.KeyIdentifier,
+			PublicKey: publicKey,
+			Current:   pk.IsCurrent,
+		})
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public keys found")
+	}
+
+	return keys, nil
+}
+
+// ParsePublicKey parses a PEM encoded ECDSA public key. Escaped newlines, as
+// returned by the GitHub API, are accepted.
+func ParsePublicKey(rawKey string) (*ecdsa.PublicKey, error) {
+	pubPemStr := strings.ReplaceAll(rawKey, "\\n", "\n")
+
+	block, _ := pem.Decode([]byte(pubPemStr))
+	if block == nil {
+		return nil, fmt.Errorf("error parsing PEM block with public key")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not ECDSA")
+	}
+
+	return ecdsaKey, nil
+}
@@ -0,0 +1,183 @@
+package signature
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// minRefreshInterval limits how often unknown key identifiers trigger a
+// refresh, so forged requests can't flood the key source.
+const minRefreshInterval = time.Minute
+
+// refreshTimeout limits how long loading the keys may take.
+const refreshTimeout = 10 * time.Second
+
+var (
+	// ErrUnknownKey is returned for requests signed with a key the source
+	// doesn't publish
+	ErrUnknownKey = errors.New("unknown public key")
+
+	// ErrInvalidSignature is returned when the signature doesn't match the
+	// payload
+	ErrInvalidSignature = errors.New("invalid payload signature")
+)
+
+// Verifier checks that requests are signed by GitHub. It caches the keys of
+// its source and only loads them when needed, so the server starts without
+// access to GitHub.
+type Verifier struct {
+	source KeySource
+
+	mu          sync.RWMutex
+	keys        map[string]*ecdsa.PublicKey
+	current     *ecdsa.PublicKey
+	lastRefresh time.Time
+	lastErr     error
+
+	// refreshMu serializes refreshes, concurrent requests with an unknown key
+	// wait for the same refresh
+	refreshMu sync.Mutex
+}
+
+func NewVerifier(source KeySource) *Verifier {
+	return &Verifier{
+		source: source,
+		keys:   make(map[string]*ecdsa.PublicKey),
+	}
+}
+
+// Verify checks that signature is a valid signature of payload by the key with
+// the given identifier. Without identifier the current key is used.
+func (v *Verifier) Verify(ctx context.Context, payload []byte, signature, keyID string) error {
+	key, err := v.key(ctx, keyID)
+	if err != nil {
+		return err
+	}
+
+	return verify(payload, signature, key)
+}
+
+// HasKeys reports whether keys have been loaded.
+func (v *Verifier) HasKeys() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	return len(v.keys) > 0
+}
+
+// Refresh loads the keys from the source. Calls within minRefreshInterval of
+// the last refresh are skipped and return its error.
+func (v *Verifier) Refresh(ctx context.Context) error {
+	v.refreshMu.Lock()
+	defer v.refreshMu.Unlock()
+
+	v.mu.RLock()
+	recent := !v.lastRefresh.IsZero() && time.Since(v.lastRefresh) < minRefreshInterval
+	lastErr := v.lastErr
+	v.mu.RUnlock()
+
+	if recent {
+		return lastErr
+	}
+
+	// A refresh serves all waiting requests, it must not fail because the
+	// request which started it was cancelled
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+	defer cancel()
+
+	keys, err := v.source.Keys(ctx)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// Failed refreshes are rate limited as well
+	v.lastRefresh = time.Now()
+	v.lastErr = err
+
+	if err != nil {
+		return err
+	}
+
+	v.keys = make(map[string]*ecdsa.PublicKey, len(keys))
+	v.current = nil
+
+	for _, key := range keys {
+		v.keys[key.ID] = key.PublicKey
+
+		if key.Current {
+			v.current = key.PublicKey
+		}
+	}
+
+	log.Infof("Loaded %d public keys", len(keys))
+
+	return nil
+}
+
+// key returns the key with the identifier, refreshing the keys once if it is
+// unknown.
+func (v *Verifier) key(ctx context.Context, keyID string) (*ecdsa.PublicKey, error) {
+	if key, ok := v.cached(keyID); ok {
+		return key, nil
+	}
+
+	if err := v.Refresh(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh public keys: %w", err)
+	}
+
+	if key, ok := v.cached(keyID); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+}
+
+func (v *Verifier) cached(keyID string) (*ecdsa.PublicKey, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if keyID == "" {
+		return v.current, v.current != nil
+	}
+
+	key, ok := v.keys[keyID]
+
+	return key, ok
+}
+
+// asn1Signature is a struct for ASN.1 serializing/parsing signatures.
+type asn1Signature struct {
+	R *big.Int
+	S *big.Int
+}
+
+func verify(data []byte, sig string, publicKey *ecdsa.PublicKey) error {
+	asnSig, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	parsedSig := asn1Signature{}
+	rest, err := asn1.Unmarshal(asnSig, &parsedSig)
+	if err != nil || len(rest) != 0 {
+		return fmt.Errorf("%w: malformed signature", ErrInvalidSignature)
+	}
+
+	// Verify the SHA256 encoded payload against the signature with GitHub's Key
+	digest := sha256.Sum256(data)
+	if !ecdsa.Verify(publicKey, digest[:], parsedSig.R, parsedSig.S) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}